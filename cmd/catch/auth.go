@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// serverPubKeyName is the name the -server-public-key-path key is
+// registered under
+const serverPubKeyName = "catch"
+
+// authOptions are the resolved authentication plugin settings.
+type authOptions struct {
+	// Cleartext allows the mysql_clear_password plugin used by PAM and LDAP
+	Cleartext bool
+	// FallbackToPlaintext lets a REQUIRED or VERIFY_* TLS mode connect
+	// unencrypted to a server without TLS
+	FallbackToPlaintext bool
+	// ServerPublicKey is a PEM file with the server's RSA public key, which
+	// caching_sha2_password and sha256_password use to encrypt the password
+	// on connections without TLS
+	ServerPublicKey string
+}
+
+// configureAuth applies the authentication plugin options to cfg. Without
+// -server-public-key-path the driver asks the server for its key.
+func configureAuth(cfg *mysql.Config, auth authOptions) error {
+	if auth.Cleartext {
+		cfg.AllowCleartextPasswords = true
+		if (cfg.TLSConfig == "" || cfg.TLSConfig == "false") && cfg.Net != "unix" {
+			fmt.Fprintln(os.Stderr, "Warning: -enable-cleartext-plugin sends the password unencrypted without TLS, consider -ssl-mode REQUIRED")
+		}
+	}
+	if auth.FallbackToPlaintext {
+		cfg.AllowFallbackToPlaintext = true
+	}
+	if auth.ServerPublicKey != "" {
+		key, err := readServerPublicKey(auth.ServerPublicKey)
+		if err != nil {
+			return err
+		}
+		mysql.RegisterServerPubKey(serverPubKeyName, key)
+		cfg.ServerPubKey = serverPubKeyName
+	}
+	return nil
+}
+
+// readServerPublicKey reads an RSA public key in the PEM formats the server
+// writes: PKIX, as in public_key.pem, or PKCS #1.
+func readServerPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading server-public-key-path: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("server-public-key-path %s contains no PEM key", path)
+	}
+	if !strings.Contains(block.Type, "PUBLIC KEY") {
+		return nil, fmt.Errorf("server-public-key-path %s holds a %s, not the server's public key", path, block.Type)
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing server-public-key-path %s: %w", path, err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("server-public-key-path %s is not an RSA public key", path)
+	}
+	return key, nil
+}
+
+// authError replaces a driver error, whose advice is about DSN parameters,
+// with the flag that fixes it.
+type authError struct {
+	hint string
+	err  error
+}
+
+func (e *authError) Error() string { return e.hint }
+func (e *authError) Unwrap() error { return e.err }
+
+// explainAuthError turns the driver's authentication plugin errors into
+// advice on the matching flag, and returns any other error unchanged.
+func explainAuthError(err error) error {
+	var hint string
+	switch {
+	case errors.Is(err, mysql.ErrCleartextPassword):
+		hint = "the account authenticates with a cleartext plugin such as PAM or LDAP; pass -enable-cleartext-plugin, preferably with -ssl-mode REQUIRED"
+	case errors.Is(err, mysql.ErrNativePassword):
+		hint = "the account uses mysql_native_password, which the -dsn disables with allowNativePasswords=false"
+	case errors.Is(err, mysql.ErrOldPassword):
+		hint = "the account uses the pre-4.1 old_password hash; reset its password or add allowOldPasswords=true to a -dsn"
+	case errors.Is(err, mysql.ErrUnknownPlugin):
+		hint = "the account uses an authentication plugin the MySQL driver does not support"
+	case errors.Is(err, mysql.ErrNoTLS):
+		hint = "the server does not support TLS; use -ssl-mode PREFERRED, or -allow-fallback-to-plaintext to keep the certificate checks when TLS is offered"
+	default:
+		return err
+	}
+	return &authError{hint: hint, err: err}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// defaultCharset keeps 4-byte characters such as emoji intact in INFO
+const defaultCharset = "utf8mb4"
+
+// configureCharset sets the connection character set and collation, sent
+// as SET NAMES when connecting. An empty collation uses the server's
+// default for the character set.
+func configureCharset(cfg *mysql.Config, charset, collation string) error {
+	if charset == "" {
+		charset = defaultCharset
+	}
+	// The driver already negotiates utf8mb4 in the handshake, so the
+	// default costs no extra round trip unless a -dsn asked for another
+	if charset == defaultCharset && collation == "" && dsnParams(cfg).Get("charset") == "" {
+		return nil
+	}
+	if err := cfg.Apply(mysql.Charset(charset, collation)); err != nil {
+		return fmt.Errorf("setting character set %s: %w", charset, err)
+	}
+	return nil
+}
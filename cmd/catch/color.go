@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Values of -color
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+var colorModes = []string{colorAuto, colorAlways, colorNever}
+
+func validateColorMode(mode string) error {
+	for _, m := range colorModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown -color mode %q (valid: %s)", mode, strings.Join(colorModes, ", "))
+}
+
+// colorEnabled reports whether terminal output written to out is colored. In
+// auto mode color is dropped when NO_COLOR is set (https://no-color.org),
+// when TERM is dumb, or when out is a pipe or a file rather than a terminal.
+func colorEnabled(mode string, out *os.File) bool {
+	switch mode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(out.Fd()))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// configureCompression asks for the compressed protocol when enabled. A -dsn
+// may also enable it with compress=true.
+func configureCompression(cfg *mysql.Config, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	if err := cfg.Apply(mysql.EnableCompression(true)); err != nil {
+		return fmt.Errorf("enabling compression: %w", err)
+	}
+	return nil
+}
+
+// compressionRequested reports whether cfg asks for the compressed protocol,
+// either from configureCompression or a -dsn.
+func compressionRequested(cfg *mysql.Config) bool {
+	// The option is unexported, so read it back from the formatted DSN
+	return dsnParams(cfg).Get("compress") == "true"
+}
+
+// dsnParams returns the parameters of cfg formatted as a DSN. The
+// parameters follow the last '/', after any password.
+func dsnParams(cfg *mysql.Config) url.Values {
+	dsn := cfg.FormatDSN()
+	_, params, _ := strings.Cut(dsn[strings.LastIndex(dsn, "/"):], "?")
+	values, _ := url.ParseQuery(params)
+	return values
+}
+
+// compressionStatus returns the session's Compression status, ON or OFF.
+// The driver silently falls back to an uncompressed connection when the
+// server doesn't offer compression, so this is what was negotiated.
+func compressionStatus(ctx context.Context, db *sql.DB) string {
+	var name, value string
+	if err := db.QueryRowContext(ctx, "SHOW SESSION STATUS LIKE 'Compression'").Scan(&name, &value); err != nil {
+		return "unknown"
+	}
+	return strings.ToUpper(value)
+}
+
+// reportCompression warns when compression was requested but the server
+// didn't negotiate it, and in verbose mode always prints the outcome.
+func reportCompression(ctx context.Context, db *sql.DB, requested, verbose bool) {
+	if !requested && !verbose {
+		return
+	}
+	status := compressionStatus(ctx, db)
+	if requested && status != "ON" {
+		fmt.Fprintf(os.Stderr, "Warning: compression was requested but not negotiated (Compression=%s), continuing uncompressed\n", status)
+		return
+	}
+	if verbose {
+		fmt.Printf("Compression: %s\n", status)
+	}
+}
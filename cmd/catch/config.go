@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type MySQLConfig struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Socket   string
+	SSLMode  string
+	SSLCA    string
+	SSLCert  string
+	SSLKey   string
+	Compress bool
+	Charset  string
+	// Authentication plugin options, as the mysql client reads them
+	EnableCleartextPlugin bool
+	ServerPublicKeyPath   string
+}
+
+// Option groups read from .my.cnf, in order. Later groups override earlier ones.
+var defaultOptionGroups = []string{"client", "mysql"}
+
+// globalGroup holds keys that appear before the first [group] header, so
+// files written without any header keep working.
+const globalGroup = ""
+
+// optionFile maps a group name to the key/value pairs found under it.
+type optionFile map[string]map[string]string
+
+// maxIncludeDepth bounds nested !include/!includedir directives so include
+// loops fail instead of recursing forever.
+const maxIncludeDepth = 10
+
+// readOptionFile parses the option file at path into options, following
+// !include and !includedir directives. Values read later override earlier ones.
+func readOptionFile(path string, options optionFile, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes nested more than %d levels deep", path, maxIncludeDepth)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return parseOptions(string(content), path, options, depth)
+}
+
+// parseOptions parses option file content read from path into options.
+func parseOptions(content, path string, options optionFile, depth int) error {
+	group := globalGroup
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if dir, ok := strings.CutPrefix(line, "!includedir"); ok {
+			if err := readOptionDir(resolveInclude(path, dir), options, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if file, ok := strings.CutPrefix(line, "!include"); ok {
+			if err := readOptionFile(resolveInclude(path, file), options, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			group = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		// Dashes and underscores are interchangeable in option names
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+		value = parseOptionValue(value)
+		if key == "" {
+			continue
+		}
+
+		if options[group] == nil {
+			options[group] = map[string]string{}
+		}
+		options[group][key] = value
+	}
+	return nil
+}
+
+// readOptionDir reads every .cnf file in dir in sorted order.
+func readOptionDir(dir string, options optionFile, depth int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// os.ReadDir returns entries sorted by filename
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".cnf" {
+			continue
+		}
+		if err := readOptionFile(filepath.Join(dir, entry.Name()), options, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveInclude resolves an include target relative to the including file.
+func resolveInclude(from, target string) string {
+	target = strings.TrimSpace(target)
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(from), target)
+}
+
+// parseOptionValue unquotes a single or double quoted value, honoring
+// backslash escapes inside the quotes. Unquoted values end at the first '#'.
+func parseOptionValue(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || (raw[0] != '"' && raw[0] != '\'') {
+		if i := strings.Index(raw, "#"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw)
+	}
+
+	quote := raw[0]
+	var value strings.Builder
+	for i := 1; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			switch raw[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 's':
+				value.WriteByte(' ')
+			default:
+				value.WriteByte(raw[i])
+			}
+		case c == quote:
+			// Anything after the closing quote is a comment
+			return value.String()
+		default:
+			value.WriteByte(c)
+		}
+	}
+	// Unterminated quote, keep what we have
+	return value.String()
+}
+
+func (c *MySQLConfig) apply(options map[string]string) {
+	for key, value := range options {
+		switch key {
+		case "user":
+			c.User = value
+		case "password":
+			c.Password = value
+		case "host":
+			c.Host = value
+		case "port":
+			c.Port = value
+		case "socket":
+			c.Socket = value
+		case "ssl-mode":
+			c.SSLMode = value
+		case "ssl-ca":
+			c.SSLCA = value
+		case "ssl-cert":
+			c.SSLCert = value
+		case "ssl-key":
+			c.SSLKey = value
+		case "compress":
+			c.Compress = parseOptionBool(value)
+		case "default-character-set":
+			c.Charset = value
+		case "enable-cleartext-plugin":
+			c.EnableCleartextPlugin = parseOptionBool(value)
+		case "server-public-key-path":
+			c.ServerPublicKeyPath = value
+		}
+	}
+}
+
+// parseOptionBool reads a boolean option. A bare option name, as in
+// "compress" on its own line, enables it.
+func parseOptionBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "", "1", "true", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+// withGroupSuffix adds the [<group><suffix>] variant after each group, as
+// --defaults-group-suffix does for the mysql client, so suffixed values
+// override their base group.
+func withGroupSuffix(groups []string, suffix string) []string {
+	if suffix == "" {
+		return groups
+	}
+	var all []string
+	for _, group := range groups {
+		all = append(all, group, group+strings.ToLower(suffix))
+	}
+	return all
+}
+
+// printDefaults writes the options picked up from the option files, one per
+// line like mysql --print-defaults, with the password masked.
+func printDefaults(w io.Writer, config MySQLConfig, groups []string) {
+	fmt.Fprintf(w, "Groups read: %s\n", strings.Join(groups, ", "))
+	if config.User != "" {
+		fmt.Fprintf(w, "--user=%s\n", config.User)
+	}
+	if config.Password != "" {
+		fmt.Fprintln(w, "--password=*****")
+	}
+	if config.Host != "" {
+		fmt.Fprintf(w, "--host=%s\n", config.Host)
+	}
+	if config.Port != "" {
+		fmt.Fprintf(w, "--port=%s\n", config.Port)
+	}
+	if config.Socket != "" {
+		fmt.Fprintf(w, "--socket=%s\n", config.Socket)
+	}
+	if config.Compress {
+		fmt.Fprintln(w, "--compress")
+	}
+	if config.EnableCleartextPlugin {
+		fmt.Fprintln(w, "--enable-cleartext-plugin")
+	}
+	for _, opt := range []struct{ name, value string }{
+		{"default-character-set", config.Charset},
+		{"ssl-mode", config.SSLMode},
+		{"ssl-ca", config.SSLCA},
+		{"ssl-cert", config.SSLCert},
+		{"ssl-key", config.SSLKey},
+		{"server-public-key-path", config.ServerPublicKeyPath},
+	} {
+		if opt.value != "" {
+			fmt.Fprintf(w, "--%s=%s\n", opt.name, opt.value)
+		}
+	}
+}
+
+// Global option files read before the user's own, as the mysql client does
+var globalOptionFiles = []string{"/etc/my.cnf", "/etc/mysql/my.cnf"}
+
+// optionSource selects which option files are read, mirroring the mysql
+// client's --defaults-file and --defaults-extra-file options.
+type optionSource struct {
+	DefaultsFile      string
+	DefaultsExtraFile string
+	// UserFile is the user's own option file, read after the others unless
+	// there's a DefaultsFile; see userOptionFile
+	UserFile string
+	// LoginFile is the encrypted login path file, see loginFilePath
+	LoginFile string
+	LoginPath string
+}
+
+// userOptionFile is ~/.my.cnf, or empty without a home directory.
+func userOptionFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".my.cnf")
+}
+
+// readMySQLConfig reads the option files selected by source. Like the
+// mysql client, each file is applied in turn, its global keys and then each
+// of groups in order, so a later file wins over an earlier one whatever
+// the group. A login path is read from source.LoginFile last. Missing
+// optional files are skipped.
+func readMySQLConfig(source optionSource, groups []string) (MySQLConfig, error) {
+	config := MySQLConfig{}
+	apply := func(options optionFile) {
+		config.apply(options[globalGroup])
+		for _, group := range groups {
+			config.apply(options[group])
+		}
+		if source.LoginPath != "" {
+			config.apply(options[source.LoginPath])
+		}
+	}
+
+	if source.DefaultsFile != "" {
+		// Only this file is read, and it has to exist
+		options := optionFile{}
+		if err := readOptionFile(source.DefaultsFile, options, 0); err != nil {
+			return MySQLConfig{}, fmt.Errorf("reading defaults file: %w", err)
+		}
+		apply(options)
+	} else {
+		paths := append([]string{}, globalOptionFiles...)
+		if source.DefaultsExtraFile != "" {
+			paths = append(paths, source.DefaultsExtraFile)
+		}
+		if source.UserFile != "" {
+			paths = append(paths, source.UserFile)
+		}
+
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				if path == source.DefaultsExtraFile {
+					return MySQLConfig{}, fmt.Errorf("reading defaults extra file: %w", err)
+				}
+				continue
+			}
+			// Includes are part of the file that names them
+			options := optionFile{}
+			if err := readOptionFile(path, options, 0); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: reading %s: %v\n", path, err)
+			}
+			apply(options)
+		}
+	}
+
+	// The login file is read last, even with a defaults file
+	options := optionFile{}
+	if err := readLoginFile(source.LoginFile, options, source.LoginPath); err != nil {
+		return MySQLConfig{}, err
+	}
+	apply(options)
+	return config, nil
+}
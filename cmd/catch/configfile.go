@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+// configAliases gives the one-letter flags a readable key in config files.
+// Every other option uses its flag name.
+var configAliases = map[string]string{
+	"host":         "h",
+	"port":         "P",
+	"username":     "u",
+	"prompt":       "p",
+	"file":         "f",
+	"interval":     "s",
+	"queries-only": "q",
+	"debug":        "d",
+	"verbose":      "v",
+	"output":       "o",
+}
+
+// listFlags take comma-separated values, which a config file may also
+// write as a list.
+var listFlags = map[string]bool{"h": true, "user": true, "exclude-user": true}
+
+// Flags that only make sense on the command line
+var commandLineOnly = map[string]bool{"config": true, "print-config": true, "version": true}
+
+// configKey returns the config file key for the flag name.
+func configKey(name string) string {
+	for key, flagName := range configAliases {
+		if flagName == name {
+			return key
+		}
+	}
+	return name
+}
+
+// loadConfigFile sets the flags listed in the YAML or TOML file at path.
+// Flags given on the command line keep their value.
+func loadConfigFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("%s: unknown config file type, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	fromCommandLine := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { fromCommandLine[f.Name] = true })
+
+	// Sorted, so the first bad key reported doesn't change between runs
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// Dashes and underscores are interchangeable, as in option files
+		name := strings.ReplaceAll(key, "_", "-")
+		if alias, ok := configAliases[name]; ok {
+			name = alias
+		}
+		if flag.Lookup(name) == nil || commandLineOnly[name] {
+			return fmt.Errorf("%s: unknown option %q", path, key)
+		}
+		if fromCommandLine[name] {
+			continue
+		}
+
+		value, err := configValue(name, values[key])
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+	return nil
+}
+
+// configValue turns a decoded config value into flag syntax.
+func configValue(name string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		// -p takes any other value as the password
+		if name == "p" && !v {
+			return "", nil
+		}
+		return fmt.Sprint(v), nil
+	case int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		if !listFlags[name] {
+			return "", fmt.Errorf("expected a single value, not a list")
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := configValue("", item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("expected a value, got %T", value)
+	}
+}
+
+// printConfig writes every option with its effective value as a YAML
+// config file that -config can read back. Passwords are masked.
+func printConfig(w io.Writer) error {
+	values := map[string]interface{}{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if commandLineOnly[f.Name] {
+			return
+		}
+		values[configKey(f.Name)] = configPrintValue(f)
+	})
+
+	out, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// configPrintValue returns the value of f as it is written by printConfig.
+func configPrintValue(f *flag.Flag) interface{} {
+	switch v := f.Value.(type) {
+	case *promptPasswordFlag:
+		if v.value != "" {
+			return "*****"
+		}
+		return v.prompt
+	case *byteSize:
+		return int64(*v)
+	case flag.Getter:
+		switch value := v.Get().(type) {
+		case time.Duration:
+			return value.String()
+		case string:
+			if f.Name == "password" && value != "" {
+				return "*****"
+			}
+			if (f.Name == "webhook" || f.Name == "slack-webhook") && value != "" {
+				if _, err := url.Parse(value); err != nil {
+					return "*****"
+				}
+				return redactURL(value)
+			}
+			if (f.Name == "dsn" || f.Name == "store-dsn") && value != "" {
+				// A DSN that doesn't parse is masked entirely rather than risk printing it
+				if cfg, err := mysql.ParseDSN(value); err == nil {
+					return redactDSN(cfg)
+				}
+				return "*****"
+			}
+			return value
+		default:
+			return value
+		}
+	}
+	return f.Value.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/fatih/color"
+)
+
+// diffProcesses compares a poll with the previous one, keyed by process ID.
+// A process that moved on to another statement counts as finished and
+// started again.
+func diffProcesses(previous map[int64]catch.Process, current []catch.Process) (started, finished []catch.Process) {
+	seen := make(map[int64]bool, len(current))
+	for _, p := range current {
+		seen[p.ID] = true
+		if before, ok := previous[p.ID]; !ok {
+			started = append(started, p)
+		} else if before.Info != p.Info {
+			finished = append(finished, before)
+			started = append(started, p)
+		}
+	}
+	for id, p := range previous {
+		if !seen[id] {
+			finished = append(finished, p)
+		}
+	}
+	return started, finished
+}
+
+// diff renders the processes that finished since the last poll, as -
+// lines, and those that started, as + lines, for -diff.
+func (m *monitor) diff(shown []catch.Process) string {
+	started, finished := diffProcesses(m.previous, shown)
+	m.previous = make(map[int64]catch.Process, len(shown))
+	for _, p := range shown {
+		m.previous[p.ID] = p
+	}
+
+	// The previous poll is a map, so finished processes are put back in
+	// the -sort order
+	m.c.order.sort(finished)
+	var b strings.Builder
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	for _, p := range finished {
+		b.WriteString(diffLine(timestamp, m.prefix(), color.New(color.FgRed).Sprint("-"), p))
+	}
+	for _, p := range started {
+		b.WriteString(diffLine(timestamp, m.prefix(), color.New(color.FgGreen).Sprint("+"), p))
+	}
+	return b.String()
+}
+
+// diffLine is one -diff line: the process, how long it had been running
+// and its statement on one line, or its command when it has none.
+func diffLine(timestamp, prefix, sign string, p catch.Process) string {
+	statement := strings.Join(strings.Fields(p.Info.String), " ")
+	if statement == "" {
+		statement = p.Command
+	}
+	db := p.DB.String
+	if !p.DB.Valid {
+		db = "-"
+	}
+	running := p.FormatTime()
+	if !p.TimeMS.Valid {
+		running += "s"
+	}
+	return fmt.Sprintf("%s %s%s %d %s@%s %s (%s): %s\n",
+		timestamp, prefix, sign, p.ID, p.User, p.Host, db, running, statement)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const defaultPort = "3306"
+
+// endpoint is where the driver connects: a TCP host:port or a unix socket path.
+type endpoint struct {
+	Network string
+	Address string
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid port %q: not a number", port)
+	}
+	if n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %d: must be between 1 and 65535", n)
+	}
+	return nil
+}
+
+// defaultSockets are where MySQL and MariaDB packages put the server
+// socket, tried in order when the host is localhost and none is configured.
+var defaultSockets = []string{
+	"/var/run/mysqld/mysqld.sock", // Debian and Ubuntu
+	"/var/lib/mysql/mysql.sock",   // RHEL and Fedora
+	"/tmp/mysql.sock",             // upstream tarballs and Homebrew
+}
+
+// resolveEndpoint follows the mysql client: localhost connects through the
+// unix socket, any other host over TCP. A -socket is used as given. A
+// socket from the environment or an option file, or the default ones, is
+// only used when it exists; otherwise the connection falls back to TCP on
+// 127.0.0.1 with a notice.
+func resolveEndpoint(host, port string, socket setting) (endpoint, error) {
+	var tried []string
+	if host == "localhost" {
+		if socket.Source == sourceFlag {
+			return endpoint{Network: "unix", Address: socket.Value}, nil
+		}
+		tried = defaultSockets
+		if socket.Value != "" {
+			tried = []string{socket.Value}
+		}
+		for _, path := range tried {
+			if isSocket(path) {
+				return endpoint{Network: "unix", Address: path}, nil
+			}
+		}
+		host = "127.0.0.1"
+	}
+
+	if err := validatePort(port); err != nil {
+		return endpoint{}, err
+	}
+	if tried != nil {
+		fmt.Fprintf(os.Stderr, "Notice: no server socket at %s, connecting to localhost over TCP %s\n",
+			strings.Join(tried, ", "), net.JoinHostPort(host, port))
+	}
+	// JoinHostPort brackets IPv6 literals, e.g. [2001:db8::5]:3306
+	return endpoint{Network: "tcp", Address: net.JoinHostPort(host, port)}, nil
+}
+
+// isSocket reports whether path is a unix socket.
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// splitHostPort splits an optional port off a host value, accepting
+// host:port, [ipv6]:port and [ipv6]. A bare IPv6 literal has no port.
+func splitHostPort(value string) (host, port string) {
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		return value[1 : len(value)-1], ""
+	}
+	if strings.Count(value, ":") > 1 && !strings.HasPrefix(value, "[") {
+		return value, ""
+	}
+	if h, p, err := net.SplitHostPort(value); err == nil {
+		return h, p
+	}
+	return value, ""
+}
+
+// buildDriverConfig builds the go-sql-driver config for ep. Letting the
+// driver format the DSN keeps special characters in the password intact.
+func buildDriverConfig(settings connectionSettings, ep endpoint) *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = settings.User.Value
+	cfg.Passwd = settings.Password.Value
+	cfg.Net = ep.Network
+	cfg.Addr = ep.Address
+	applyRequiredParams(cfg)
+	return cfg
+}
+
+// applyRequiredParams sets the driver options the tool relies on, including
+// on configs parsed from -dsn.
+func applyRequiredParams(cfg *mysql.Config) {
+	cfg.ParseTime = true
+}
+
+// applyTimeouts sets the driver's connect, read and write timeouts, unless
+// a -dsn already set them.
+func applyTimeouts(cfg *mysql.Config, connect, read, write time.Duration) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = connect
+	}
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = read
+	}
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = write
+	}
+}
+
+// isTimeout reports whether a query that failed after elapsed hit the read
+// timeout, or the poll's deadline. The driver turns I/O timeouts into a
+// generic invalid connection error, so the elapsed time is the reliable
+// signal.
+func isTimeout(err error, elapsed, readTimeout time.Duration) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return readTimeout > 0 && elapsed >= readTimeout
+}
+
+// redactDSN formats cfg for display with the password masked.
+func redactDSN(cfg *mysql.Config) string {
+	redacted := *cfg
+	if redacted.Passwd != "" {
+		redacted.Passwd = "*****"
+	}
+	return redacted.FormatDSN()
+}
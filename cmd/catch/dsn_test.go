@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		value      string
+		host, port string
+	}{
+		{"db1", "db1", ""},
+		{"db1:3307", "db1", "3307"},
+		{"db1.example.com:3307", "db1.example.com", "3307"},
+		{"10.0.0.5", "10.0.0.5", ""},
+		{"10.0.0.5:3307", "10.0.0.5", "3307"},
+		{"::1", "::1", ""},
+		{"2001:db8::5", "2001:db8::5", ""},
+		{"[::1]", "::1", ""},
+		{"[::1]:3307", "::1", "3307"},
+		{"[2001:db8::5]:3307", "2001:db8::5", "3307"},
+		{"localhost", "localhost", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		host, port := splitHostPort(tt.value)
+		if host != tt.host || port != tt.port {
+			t.Errorf("splitHostPort(%q) = %q, %q, want %q, %q", tt.value, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestResolveEndpoint(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "mysql.sock")
+	tests := []struct {
+		name   string
+		host   string
+		port   string
+		socket setting
+		want   endpoint
+	}{
+		{"hostname", "db1", "3306", setting{}, endpoint{"tcp", "db1:3306"}},
+		{"hostname with -P", "db1", "3307", setting{}, endpoint{"tcp", "db1:3307"}},
+		{"IPv4", "10.0.0.5", "3306", setting{}, endpoint{"tcp", "10.0.0.5:3306"}},
+		{"bare IPv6", "::1", "3306", setting{}, endpoint{"tcp", "[::1]:3306"}},
+		{"IPv6 with -P", "2001:db8::5", "3307", setting{}, endpoint{"tcp", "[2001:db8::5]:3307"}},
+		{"socket flag", "localhost", "3306", setting{"/run/my.sock", sourceFlag}, endpoint{"unix", "/run/my.sock"}},
+		{"missing socket falls back to TCP", "localhost", "3307", setting{missing, sourceOptionFile}, endpoint{"tcp", "127.0.0.1:3307"}},
+		{"socket ignored for another host", "db1", "3306", setting{"/run/my.sock", sourceFlag}, endpoint{"tcp", "db1:3306"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveEndpoint(tt.host, tt.port, tt.socket)
+			if err != nil {
+				t.Fatalf("resolveEndpoint: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	for _, port := range []string{"", "abc", "0", "65536"} {
+		if _, err := resolveEndpoint("db1", port, setting{}); err == nil {
+			t.Errorf("port %q accepted", port)
+		}
+	}
+}
+
+// TestHostFlagDSN follows -h and -P through the settings to the DSN.
+func TestHostFlagDSN(t *testing.T) {
+	for _, name := range []string{"MYSQL_HOST", "MYSQL_TCP_PORT", "MYSQL_UNIX_PORT", "CATCH_PASSWORD", "MYSQL_PWD"} {
+		t.Setenv(name, "")
+	}
+	tests := []struct {
+		host, port string
+		want       string
+	}{
+		{"db1", "", "app@tcp(db1:3306)/"},
+		{"db1", "3308", "app@tcp(db1:3308)/"},
+		{"db1:3307", "", "app@tcp(db1:3307)/"},
+		{"10.0.0.5", "", "app@tcp(10.0.0.5:3306)/"},
+		{"10.0.0.5:3307", "", "app@tcp(10.0.0.5:3307)/"},
+		{"::1", "", "app@tcp([::1]:3306)/"},
+		{"2001:db8::5", "3308", "app@tcp([2001:db8::5]:3308)/"},
+		{"[::1]:3307", "", "app@tcp([::1]:3307)/"},
+		{"[2001:db8::5]", "", "app@tcp([2001:db8::5]:3306)/"},
+	}
+	for _, tt := range tests {
+		settings := resolveSettings(connectionFlags{User: "app", Host: tt.host, Port: tt.port}, MySQLConfig{})
+		ep, err := resolveEndpoint(settings.Host.Value, settings.Port.Value, settings.Socket)
+		if err != nil {
+			t.Errorf("-h %s -P %s: %v", tt.host, tt.port, err)
+			continue
+		}
+		cfg := buildDriverConfig(settings, ep)
+		cfg.ParseTime = false
+		if got := cfg.FormatDSN(); got != tt.want {
+			t.Errorf("-h %s -P %s: got DSN %s, want %s", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Capture file compressions for -compress-output
+const (
+	compressGzip = "gzip"
+	compressZstd = "zstd"
+)
+
+// compressionExt is the file name ending of compression.
+func compressionExt(compression string) string {
+	switch compression {
+	case compressGzip:
+		return ".gz"
+	case compressZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+func validateCompression(compression string) error {
+	switch compression {
+	case "", compressGzip, compressZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown -compress-output %q (valid: %s, %s)", compression, compressGzip, compressZstd)
+}
+
+// compressor is a gzip or zstd stream.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressedFile is an open capture file written through gzip or zstd.
+// Compressing holds data back until it is flushed, so unlike plain files
+// it stays open between polls, and it is flushed every -flush-interval.
+type compressedFile struct {
+	name    string
+	file    *os.File
+	writer  compressor
+	flushed time.Time
+}
+
+// openCompressedFile appends to the capture file name. Each open starts a
+// new gzip member or zstd frame after those of an earlier run, which
+// readers decode as one stream.
+func openCompressedFile(name, compression string) (*compressedFile, error) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var writer compressor
+	switch compression {
+	case compressGzip:
+		writer = gzip.NewWriter(file)
+	case compressZstd:
+		if writer, err = zstd.NewWriter(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &compressedFile{name: name, file: file, writer: writer, flushed: time.Now()}, nil
+}
+
+// write compresses b, flushing it to the file once flushInterval has
+// passed since the last flush.
+func (f *compressedFile) write(b []byte, flushInterval time.Duration) error {
+	if _, err := f.writer.Write(b); err != nil {
+		return fmt.Errorf("writing %s: %w", f.name, err)
+	}
+	if time.Since(f.flushed) < flushInterval {
+		return nil
+	}
+	f.flushed = time.Now()
+	if err := f.writer.Flush(); err != nil {
+		return fmt.Errorf("writing %s: %w", f.name, err)
+	}
+	return nil
+}
+
+// Close ends the compressed stream, so the file isn't cut off mid-stream.
+func (f *compressedFile) Close() error {
+	if err := f.writer.Close(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("closing %s: %w", f.name, err)
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// processFilter holds the user-selected filters applied to every process
+// before it is written and printed. Empty fields match everything.
+type processFilter struct {
+	Users map[string]bool
+	// ExcludeUsers drops processes of these users, even when in Users
+	ExcludeUsers map[string]bool
+	// DB matches the default schema; nullDB selects connections without one
+	DB string
+	// MinTime drops processes running for fewer seconds
+	MinTime int
+	// Match keeps only processes whose INFO matches
+	Match *regexp.Regexp
+	// Blocked keeps only processes waiting on a lock
+	Blocked bool
+}
+
+const nullDB = "NULL"
+
+func newSet(items []string) map[string]bool {
+	if len(items) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+func (f processFilter) match(p catch.Process) bool {
+	if p.Time < f.MinTime {
+		return false
+	}
+	if f.Users != nil && !f.Users[p.User] {
+		return false
+	}
+	if f.ExcludeUsers[p.User] {
+		return false
+	}
+	if f.DB == nullDB && p.DB.Valid {
+		return false
+	}
+	if f.DB != "" && f.DB != nullDB && (!p.DB.Valid || p.DB.String != f.DB) {
+		return false
+	}
+	if f.Match != nil && !f.Match.MatchString(p.Info.String) {
+		return false
+	}
+	if f.Blocked && !catch.IsBlockedState(p.State.String) {
+		return false
+	}
+	return true
+}
+
+// selects reports whether p is captured: it passes the filters, is a query
+// with -q, and isn't our own monitoring query unless in debug mode or with
+// -show-self.
+func (c *capture) selects(p catch.Process) bool {
+	if !c.opts.Debug && !c.opts.ShowSelf && catch.IsMonitoringQuery(p.Info.String) {
+		return false
+	}
+	if !c.filter.match(p) {
+		return false
+	}
+	return !c.opts.Query || catch.ClassifyQuery(p.Info.String).IsQuery()
+}
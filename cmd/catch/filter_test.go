@@ -0,0 +1,74 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+func queryProcess(info string) catch.Process {
+	return catch.Process{ID: 1, User: "app", Command: "Query", Info: sql.NullString{String: info, Valid: info != ""}}
+}
+
+func TestQueryOnlyKeepsMixedCaseStatements(t *testing.T) {
+	c := &capture{opts: &options{Query: true}}
+	tests := []struct {
+		info string
+		want bool
+	}{
+		{"SELECT * FROM orders", true},
+		{"select * from orders", true},
+		{"Select * From orders", true},
+		{"/* app */ SELECT 1", true},
+		{"INSERT INTO orders VALUES (1)", true},
+		{"Update orders SET paid = 1", true},
+		{"DELETE FROM orders", true},
+		{"ALTER TABLE orders ADD c INT", true},
+		{"SHOW PROCESSLIST", false},
+		{"COMMIT", false},
+		{"", false},
+		{"SELECT * FROM performance_schema.processlist ORDER BY TIME DESC", false},
+	}
+	for _, tt := range tests {
+		if got := c.selects(queryProcess(tt.info)); got != tt.want {
+			t.Errorf("-q on %q: selected %v, want %v", tt.info, got, tt.want)
+		}
+	}
+
+	// Without -q every statement but our own is kept
+	c.opts.Query = false
+	if !c.selects(queryProcess("COMMIT")) {
+		t.Error("COMMIT dropped without -q")
+	}
+	c.opts.ShowSelf = true
+	if !c.selects(queryProcess("SELECT * FROM performance_schema.processlist ORDER BY TIME DESC")) {
+		t.Error("the monitoring query dropped with -show-self")
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	f := processFilter{Match: regexp.MustCompile("(?i)from orders")}
+	for info, want := range map[string]bool{
+		"SELECT * FROM orders":       true,
+		"select * from orders":       true,
+		"SELECT * FROM customers":    false,
+		"UPDATE orders SET paid = 1": false,
+	} {
+		if got := f.match(queryProcess(info)); got != want {
+			t.Errorf("-match on %q: matched %v, want %v", info, got, want)
+		}
+	}
+
+	// -match is a plain regular expression, case-sensitive unless it says otherwise
+	f.Match = regexp.MustCompile("FROM orders")
+	if f.match(queryProcess("select * from orders")) {
+		t.Error("case-sensitive -match matched a lowercase statement")
+	}
+
+	f = processFilter{Users: newSet([]string{"app"}), ExcludeUsers: newSet([]string{"app"})}
+	if f.match(queryProcess("SELECT 1")) {
+		t.Error("-exclude-user didn't win over -user")
+	}
+}
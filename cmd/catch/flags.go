@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// options holds the command line flags.
+type options struct {
+	Host                 string
+	Port                 int
+	Socket               string
+	User                 string
+	Password             string
+	Prompt               promptPasswordFlag
+	PasswordFile         string
+	PasswordCommand      string
+	File                 string
+	OutputDir            string
+	Interval             time.Duration
+	Query                bool
+	Debug                bool
+	Verbose              bool
+	Output               string
+	CSVNoHeader          bool
+	TrackSessions        bool
+	Groups               string
+	DefaultsFile         string
+	DefaultsExtraFile    string
+	GroupSuffix          string
+	PrintDefaults        bool
+	Kill                 bool
+	KillTime             int
+	ExplainTime          int
+	Yes                  bool
+	LoginPath            string
+	UserFilter           string
+	ExcludeUsers         string
+	DBFilter             string
+	MinTime              int
+	DSN                  string
+	Match                string
+	Where                string
+	IncludeSleep         bool
+	Locks                bool
+	Blocking             bool
+	Repl                 bool
+	ReplLagThreshold     int
+	SSLMode              string
+	SSLCA                string
+	SSLCert              string
+	SSLKey               string
+	AWSIAMAuth           bool
+	AWSRegion            string
+	ConnectTimeout       time.Duration
+	ReadTimeout          time.Duration
+	WriteTimeout         time.Duration
+	MetricsAddr          string
+	ConnectRetries       int
+	ConnectRetryInterval time.Duration
+	Wait                 bool
+	Summary              bool
+	SummaryRefresh       bool
+	ByUser               bool
+	Diff                 bool
+	AlertTime            int
+	Webhook              string
+	SlackWebhook         string
+	StoreDSN             string
+	StoreTable           string
+	MaxOpenConns         int
+	MaxIdleConns         int
+	ConnMaxLifetime      time.Duration
+	EnableCleartext      bool
+	PlaintextFallback    bool
+	ServerPubKeyPath     string
+	Compress             bool
+	Once                 bool
+	Duration             time.Duration
+	Count                int
+	MergeOutput          bool
+	Dedup                bool
+	DedupInterval        time.Duration
+	HostsFile            string
+	MaxSize              byteSize
+	RotateInterval       time.Duration
+	Retention            retentionAge
+	MaxTotalSize         byteSize
+	RetentionDryRun      bool
+	CompressOutput       string
+	Gzip                 bool
+	FlushInterval        time.Duration
+	RowGroupPolls        int
+	WithReplicas         bool
+	Stdout               bool
+	Quiet                bool
+	Syslog               bool
+	SyslogAddr           string
+	ProxySQL             bool
+	Color                string
+	ConfigFile           string
+	PrintConfig          bool
+	Top                  int
+	ShowSelf             bool
+	Sort                 string
+	Charset              string
+	Collation            string
+	RequireProcessPriv   bool
+	Version              bool
+}
+
+func parseFlags() *options {
+	o := &options{}
+	flag.Var(hostsFlag{&o.Host}, "h", "MySQL host address, optionally with a port: db1:3307, 2001:db8::5 or [2001:db8::5]:3307.\n"+
+		"Several hosts, comma-separated or with -h repeated, are monitored at once (default: $MYSQL_HOST, .my.cnf or localhost)")
+	flag.IntVar(&o.Port, "P", 0, "MySQL port (default: $MYSQL_TCP_PORT, .my.cnf or 3306)")
+	flag.StringVar(&o.Socket, "socket", "", "Unix socket path, used when the host is localhost (default: $MYSQL_UNIX_PORT or .my.cnf)")
+	flag.StringVar(&o.User, "u", "", "MySQL user (default: from .my.cnf or $USER)")
+	flag.StringVar(&o.Password, "password", "", "MySQL password (default: $CATCH_PASSWORD, $MYSQL_PWD or .my.cnf)")
+	flag.Var(&o.Prompt, "p", "Prompt for the MySQL password, or use -p=<password>")
+	flag.StringVar(&o.PasswordFile, "password-file", "", "Read the MySQL password from the first line of this file, which must not be readable by other users")
+	flag.StringVar(&o.PasswordCommand, "password-command", "", "Run this shell command and use its output as the MySQL password, e.g. \"op read op://vault/db/password\"")
+	flag.StringVar(&o.File, "f", "", "Output file name (without date or directory); - writes to stdout instead of a file, like -stdout")
+	flag.StringVar(&o.OutputDir, "output-dir", "", "Directory for the capture files, created if missing (default: the current directory)")
+	flag.DurationVar(&o.Interval, "s", time.Second, "Poll interval, e.g. 500ms or 2s")
+	flag.BoolVar(&o.Query, "q", false, "Show only queries (SELECT, INSERT, UPDATE, DELETE and DDL statements)")
+	flag.BoolVar(&o.Debug, "d", false, "Debug mode - show all queries with timing")
+	flag.BoolVar(&o.Verbose, "v", false, "Verbose debug mode")
+	flag.StringVar(&o.Output, "o", formatText, "Capture file format: text, json or jsonl (one object per process), json-snapshot (one object per poll), csv, tsv, slowlog (for pt-query-digest), general-log or parquet (typed columns, for DuckDB and Athena); table shows an aligned table on the terminal and writes text, and sqlite:<path> stores the processes in a SQLite database")
+	flag.StringVar(&o.Output, "format", formatText, "Same as -o")
+	flag.BoolVar(&o.TrackSessions, "track-sessions", false, "With -o general-log, also write Connect and Quit lines when a connection appears or disappears; implies -include-sleep")
+	flag.BoolVar(&o.CSVNoHeader, "csv-no-header", false, "Don't start CSV capture files and streams with a header row, for pipelines that concatenate them")
+	flag.StringVar(&o.Groups, "defaults-group", "", "Comma-separated .my.cnf groups to read (default: client,mysql)")
+	flag.StringVar(&o.DefaultsFile, "defaults-file", "", "Read only this option file instead of the default ones")
+	flag.StringVar(&o.DefaultsExtraFile, "defaults-extra-file", "", "Read this option file after the global option files and before ~/.my.cnf")
+	flag.StringVar(&o.GroupSuffix, "defaults-group-suffix", "", "Also read groups with this suffix, e.g. [client<suffix>], overriding the base groups")
+	flag.BoolVar(&o.PrintDefaults, "print-defaults", false, "Print the options read from the option files and exit")
+	flag.BoolVar(&o.Kill, "kill", false, "Kill queries running longer than -kill-time (dry run unless -yes is given)")
+	flag.IntVar(&o.KillTime, "kill-time", 0, "Kill threshold in seconds for -kill")
+	flag.IntVar(&o.ExplainTime, "explain-time", 0, "Capture the EXPLAIN plan of each SELECT running longer than this many seconds")
+	flag.BoolVar(&o.Yes, "yes", false, "Actually execute kills in -kill mode")
+	flag.StringVar(&o.LoginPath, "login-path", "", "Read options from this login path in ~/.mylogin.cnf")
+	flag.StringVar(&o.UserFilter, "user", "", "Only show processes of these users (comma-separated, exact match)")
+	flag.StringVar(&o.ExcludeUsers, "exclude-user", "", "Hide processes of these users, e.g. event_scheduler,system user (comma-separated, exact match)")
+	flag.StringVar(&o.DBFilter, "db", "", "Only show processes using this default schema (NULL for none)")
+	flag.IntVar(&o.MinTime, "min-time", 0, "Only show processes running for at least this many seconds")
+	flag.StringVar(&o.DSN, "dsn", "", "Full go-sql-driver DSN; replaces the option file, host and credential flags")
+	flag.StringVar(&o.Match, "match", "", "Only show processes whose query text matches this regular expression")
+	flag.StringVar(&o.Where, "where", "", "Extra SQL condition on the processlist columns, ANDed to the query, e.g. \"USER LIKE 'app%'\"")
+	flag.BoolVar(&o.IncludeSleep, "include-sleep", false, "Also capture idle connections (COMMAND Sleep)")
+	flag.BoolVar(&o.Blocking, "blocking", false, "Also report InnoDB lock waits each poll: which process blocks which, with both statements")
+	flag.BoolVar(&o.Repl, "repl", false, "Also report the replication status each poll: lag, IO and SQL thread states and the last error")
+	flag.IntVar(&o.ReplLagThreshold, "repl-lag-threshold", 30, "Replication lag in seconds above which -repl shows the status in red")
+	flag.BoolVar(&o.Locks, "locks", false, "Only show processes waiting for a lock (STATE \"Waiting for ...\" or \"Locked\")")
+	flag.StringVar(&o.SSLMode, "ssl-mode", "", "TLS mode: DISABLED, PREFERRED, REQUIRED, VERIFY_CA or VERIFY_IDENTITY (default: from .my.cnf)")
+	flag.StringVar(&o.SSLCA, "ssl-ca", "", "CA certificate file for verifying the server")
+	flag.StringVar(&o.SSLCert, "ssl-cert", "", "Client certificate file")
+	flag.StringVar(&o.SSLKey, "ssl-key", "", "Client private key file")
+	flag.BoolVar(&o.AWSIAMAuth, "aws-iam-auth", false, "Authenticate to RDS with IAM tokens generated from the ambient AWS credentials")
+	flag.StringVar(&o.AWSRegion, "aws-region", "", "AWS region for -aws-iam-auth (default: from the RDS host name or AWS config)")
+	flag.DurationVar(&o.ConnectTimeout, "connect-timeout", 5*time.Second, "Timeout for establishing a connection")
+	flag.DurationVar(&o.ReadTimeout, "read-timeout", 30*time.Second, "Timeout for reading a query result; a poll that exceeds it is logged and skipped")
+	flag.DurationVar(&o.WriteTimeout, "write-timeout", 30*time.Second, "Timeout for sending a query")
+	flag.StringVar(&o.MetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9104")
+	flag.IntVar(&o.ConnectRetries, "connect-retries", 0, "Retry the initial connection this many times before giving up")
+	flag.DurationVar(&o.ConnectRetryInterval, "connect-retry-interval", 2*time.Second, "Delay between initial connection attempts")
+	flag.BoolVar(&o.Wait, "wait", false, "Retry the initial connection until the server is reachable")
+	flag.BoolVar(&o.Summary, "summary", false, "Print a per-poll rollup by statement type and user instead of every process")
+	flag.BoolVar(&o.SummaryRefresh, "summary-refresh", false, "Repaint the -summary rollup in place instead of appending it")
+	flag.IntVar(&o.AlertTime, "alert-time", 0, "Alert -webhook and -slack-webhook on processes running at least this many seconds, once per process")
+	flag.StringVar(&o.Webhook, "webhook", "", "POST a JSON alert to this URL for each process past -alert-time")
+	flag.StringVar(&o.SlackWebhook, "slack-webhook", "", "Post each alert of -alert-time to this Slack incoming webhook URL as a formatted message")
+	flag.StringVar(&o.StoreDSN, "store-dsn", "", "Also append the captured processes to a table on this MySQL server (go-sql-driver DSN), which must not be a monitored one")
+	flag.StringVar(&o.StoreTable, "store-table", "captures", "Table for -store-dsn, created if absent, optionally as database.table")
+	flag.BoolVar(&o.ByUser, "by-user", false, "Print the connection count and summed TIME of each user per poll instead of every process")
+	flag.BoolVar(&o.Diff, "diff", false, "Print only the changes since the last poll instead of every process: + for each process that started a statement, - for each that finished one")
+	flag.IntVar(&o.MaxOpenConns, "max-open-conns", 1, "Maximum open connections; polling only needs one")
+	flag.IntVar(&o.MaxIdleConns, "max-idle-conns", 1, "Maximum idle connections kept between polls")
+	flag.DurationVar(&o.ConnMaxLifetime, "conn-max-lifetime", 3*time.Minute,
+		"Recycle connections after this long. Keep it below the server's (or ProxySQL's) wait_timeout,\n"+
+			"otherwise long sessions hit \"invalid connection\" when the idle connection is killed server side")
+	flag.BoolVar(&o.EnableCleartext, "enable-cleartext-plugin", false, "Allow the cleartext authentication plugin used by PAM and LDAP accounts (default: enable-cleartext-plugin in .my.cnf)")
+	flag.BoolVar(&o.PlaintextFallback, "allow-fallback-to-plaintext", false, "With -ssl-mode REQUIRED, VERIFY_CA or VERIFY_IDENTITY, connect unencrypted to servers without TLS")
+	flag.StringVar(&o.ServerPubKeyPath, "server-public-key-path", "", "PEM file with the server's RSA public key, for caching_sha2_password without TLS (default: asked from the server)")
+	flag.BoolVar(&o.Compress, "compress", false, "Use the compressed client/server protocol (default: compress in .my.cnf)")
+	flag.BoolVar(&o.Once, "once", false, "Capture a single poll and exit; exits 1 if the processlist could not be read")
+	flag.DurationVar(&o.Duration, "duration", 0, "Stop after running this long, e.g. 2h (default: run until interrupted)")
+	flag.IntVar(&o.Count, "count", 0, "Stop after this many polls (default: run until interrupted)")
+	flag.BoolVar(&o.Dedup, "dedup", false, "Don't write a process to the capture file again while it runs the statement written by the previous poll")
+	flag.DurationVar(&o.DedupInterval, "dedup-interval", 0, "With -dedup, write a still running statement again this often, e.g. 30s, to show it is still running (default: never)")
+	flag.BoolVar(&o.MergeOutput, "merge-output", false, "With several -h hosts, write one capture file with a server field instead of one file per host")
+	flag.StringVar(&o.HostsFile, "hosts-file", "", "Monitor the hosts listed in this file, one \"host[:port] [alias]\" per line; SIGHUP re-reads it")
+	flag.StringVar(&o.CompressOutput, "compress-output", "", "Compress capture files with gzip or zstd, adding .gz or .zst to their names")
+	flag.BoolVar(&o.Gzip, "gzip", false, "Same as -compress-output gzip")
+	flag.DurationVar(&o.FlushInterval, "flush-interval", 5*time.Second, "With -compress-output, flush the compressed data to disk this often; 0 flushes every poll")
+	flag.IntVar(&o.RowGroupPolls, "row-group-polls", 10, "With -o parquet, write a row group to disk every this many polls")
+	flag.DurationVar(&o.RotateInterval, "rotate-interval", 0, "Start a new capture file at every boundary of this interval, e.g. 1h writes load_test-<date>T14.txt; it must divide a day (default: daily)")
+	flag.Var(&o.MaxSize, "max-size", "Start a new sequence-numbered capture file, e.g. load_test-<date>.1.txt, once the current one reaches this size, e.g. 100MB")
+	flag.Var(&o.MaxSize, "max-file-size", "Same as -max-size")
+	flag.Var(&o.Retention, "retention", "At each new capture file, delete the capture files last written longer ago than this, e.g. 7d or 12h")
+	flag.Var(&o.MaxTotalSize, "max-total-size", "At each new capture file, delete the oldest capture files while all of them together are larger than this, e.g. 10GB")
+	flag.BoolVar(&o.RetentionDryRun, "retention-dry-run", false, "Only print the capture files -retention and -max-total-size would delete")
+	flag.BoolVar(&o.WithReplicas, "with-replicas", false, "Also monitor the replicas registered with each host, rediscovered every minute")
+	flag.BoolVar(&o.Stdout, "stdout", false, "Don't write a capture file; -o json, csv and tsv records go to stdout instead of the terminal output")
+	flag.BoolVar(&o.Stdout, "no-file", false, "Same as -stdout")
+	flag.BoolVar(&o.Syslog, "syslog", false, "Send each captured process to syslog as a one-line message instead of writing a capture file")
+	flag.StringVar(&o.SyslogAddr, "syslog-addr", "", "With -syslog, send to this remote syslog server, [udp://|tcp://]host[:port] (default: the local syslog, port 514 over UDP)")
+	flag.BoolVar(&o.Quiet, "quiet", false, "Write the processes only to the capture file; connection status, errors and a stats line every minute go to stderr")
+	flag.BoolVar(&o.ProxySQL, "proxysql", false, "Monitor client sessions through the ProxySQL admin interface (default port 6032)")
+	flag.StringVar(&o.Color, "color", colorAuto, "Color terminal output: auto (unless NO_COLOR is set or stdout isn't a terminal), always or never")
+	flag.StringVar(&o.ConfigFile, "config", "", "Read options from this YAML (.yaml, .yml) or TOML (.toml) file; command line flags override it")
+	flag.BoolVar(&o.PrintConfig, "print-config", false, "Print the effective options, with -config applied, as a YAML config file and exit")
+	flag.StringVar(&o.Sort, "sort", "", "Order the processes of each poll by time, user, db or id, optionally with :asc or :desc, e.g. user:desc (default: time:desc, the others ascending)")
+	flag.BoolVar(&o.ShowSelf, "show-self", false, "Also list the tool's own connection and polling query, which are hidden by default")
+	flag.IntVar(&o.Top, "top", 0, "Only show the N longest-running processes of each poll, after filtering (default: all)")
+	flag.StringVar(&o.Charset, "default-character-set", "", "Connection character set (default: default-character-set in .my.cnf or utf8mb4)")
+	flag.StringVar(&o.Collation, "default-collation", "", "Connection collation, e.g. utf8mb4_0900_ai_ci (default: the server's default for the character set)")
+	flag.BoolVar(&o.RequireProcessPriv, "require-process-priv", false, "Exit instead of warning when the user lacks the PROCESS privilege and can only see its own sessions")
+	flag.BoolVar(&o.Version, "version", false, "Print the version, commit, build date and Go version and exit")
+	flag.Parse()
+	if err := checkArgs(flag.Args()); err != nil {
+		fatalf("%v", err)
+	}
+	if o.ConfigFile != "" {
+		if err := loadConfigFile(o.ConfigFile); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	return o
+}
+
+// checkArgs rejects arguments left after the flags. Parsing stops at the
+// first one, so the flags after it would be silently ignored; usually it
+// is a password given as -p secret, which -p reads as a prompt instead.
+func checkArgs(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unexpected argument %q, the flags after it were not read; "+
+		"give the password as -p=<password>, -p alone prompts for it", args[0])
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPasswordAfterPromptFlagIsRejected(t *testing.T) {
+	parse := func(args ...string) (*promptPasswordFlag, *bool, error) {
+		fs := flag.NewFlagSet("catch", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		prompt := &promptPasswordFlag{}
+		fs.Var(prompt, "p", "")
+		version := fs.Bool("version", false, "")
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return prompt, version, checkArgs(fs.Args())
+	}
+
+	// -p takes no value, so secret ends the flags and -version is never read
+	_, version, err := parse("-p", "secret", "-version")
+	if err == nil {
+		t.Fatal("-p secret -version accepted")
+	}
+	if *version {
+		t.Error("-version read after the argument")
+	}
+	if !strings.Contains(err.Error(), `"secret"`) || !strings.Contains(err.Error(), "-p=<password>") {
+		t.Errorf("got %q, want the argument named and -p=<password> suggested", err)
+	}
+
+	prompt, version, err := parse("-p=secret", "-version")
+	if err != nil {
+		t.Fatalf("-p=secret -version: %v", err)
+	}
+	if prompt.value != "secret" || prompt.prompt || !*version {
+		t.Errorf("-p=secret -version parsed as %+v, version %v", prompt, *version)
+	}
+
+	if _, _, err := parse("-p", "-version"); err != nil {
+		t.Errorf("-p -version: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// generalLog turns the statements of each poll into general query log
+// lines for -o general-log: a Query line when a statement is first seen
+// and, with -track-sessions, Connect and Quit lines when a connection
+// appears and disappears.
+type generalLog struct {
+	trackSessions bool
+	// statements and sessions seen by the previous poll
+	statements map[statementKey]bool
+	sessions   map[int64]bool
+}
+
+func newGeneralLog(trackSessions bool) *generalLog {
+	return &generalLog{
+		trackSessions: trackSessions,
+		statements:    map[statementKey]bool{},
+		sessions:      map[int64]bool{},
+	}
+}
+
+// poll renders the events between the previous poll and this one, which
+// captured processes at now. Connect and Quit follow every connection in
+// the processlist, Query lines only the statements of shown, the processes
+// that passed the filters.
+func (l *generalLog) poll(processes, shown []catch.Process, now time.Time) string {
+	var b strings.Builder
+	sessions := make(map[int64]bool, len(processes))
+	if l.trackSessions {
+		for _, p := range processes {
+			if !l.sessions[p.ID] {
+				b.WriteString(formatGeneralLogLine(now, p.ID, "Connect", generalLogConnect(p)))
+			}
+			sessions[p.ID] = true
+		}
+	}
+
+	statements := make(map[statementKey]bool, len(shown))
+	for _, p := range shown {
+		if p.Info.String == "" {
+			continue
+		}
+		key := statementKey{p.ID, p.Info.String}
+		if !l.statements[key] {
+			// Collapsed onto one line, whatever newlines the statement has
+			statement := strings.Join(strings.Fields(p.Info.String), " ")
+			b.WriteString(formatGeneralLogLine(now, p.ID, "Query", statement))
+		}
+		statements[key] = true
+	}
+
+	if l.trackSessions {
+		var gone []int64
+		for id := range l.sessions {
+			if !sessions[id] {
+				gone = append(gone, id)
+			}
+		}
+		sort.Slice(gone, func(i, j int) bool { return gone[i] < gone[j] })
+		for _, id := range gone {
+			b.WriteString(formatGeneralLogLine(now, id, "Quit", ""))
+		}
+	}
+
+	l.statements = statements
+	l.sessions = sessions
+	return b.String()
+}
+
+// generalLogConnect is the argument of a Connect line, as the server writes
+// it: "user@host on db".
+func generalLogConnect(p catch.Process) string {
+	host := p.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return fmt.Sprintf("%s@%s on %s", p.User, host, p.DB.String)
+}
+
+// formatGeneralLogLine renders one event in the general query log layout:
+// time, thread ID, command and argument. The thread ID is the processlist
+// ID, so lines can be matched with other captures.
+func formatGeneralLogLine(at time.Time, id int64, command, argument string) string {
+	return fmt.Sprintf("%s\t%6d %s\t%s\n", at.UTC().Format("2006-01-02T15:04:05.000000Z"), id, command, argument)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+func generalLogProcess(id int64, db, info string) catch.Process {
+	return catch.Process{
+		ID:      id,
+		User:    "app",
+		Host:    "10.0.0.1:5000",
+		DB:      sql.NullString{String: db, Valid: db != ""},
+		Command: "Query",
+		Info:    sql.NullString{String: info, Valid: info != ""},
+	}
+}
+
+// generalLogCommands lists the "id command" pairs of the lines in out.
+func generalLogCommands(out string) []string {
+	var commands []string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		commands = append(commands, fields[1]+" "+fields[2])
+	}
+	return commands
+}
+
+func TestGeneralLogSessionsIgnoreFilters(t *testing.T) {
+	l := newGeneralLog(true)
+	now := time.Now()
+
+	orders := generalLogProcess(1, "orders", "SELECT 1")
+	other := generalLogProcess(2, "other", "SELECT 2")
+	got := generalLogCommands(l.poll([]catch.Process{orders, other}, []catch.Process{orders}, now))
+	want := []string{"1 Connect", "2 Connect", "1 Query"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("first poll wrote %v, want %v", got, want)
+	}
+
+	// Process 1 no longer matches the filter but is still connected
+	orders.DB = sql.NullString{String: "other", Valid: true}
+	got = generalLogCommands(l.poll([]catch.Process{orders, other}, nil, now))
+	if len(got) != 0 {
+		t.Errorf("second poll wrote %v, want nothing", got)
+	}
+
+	got = generalLogCommands(l.poll([]catch.Process{other}, nil, now))
+	want = []string{"1 Quit"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("third poll wrote %v, want %v", got, want)
+	}
+}
+
+func TestGeneralLogQueries(t *testing.T) {
+	l := newGeneralLog(false)
+	now := time.Now()
+
+	p := generalLogProcess(7, "orders", "SELECT *\n  FROM orders")
+	out := l.poll([]catch.Process{p}, []catch.Process{p}, now)
+	if !strings.HasSuffix(out, "     7 Query\tSELECT * FROM orders\n") {
+		t.Errorf("got %q, want a Query line with the statement on one line", out)
+	}
+	if out := l.poll([]catch.Process{p}, []catch.Process{p}, now); out != "" {
+		t.Errorf("a statement still running was written again: %q", out)
+	}
+	p.Info.String = "SELECT 2"
+	if got := generalLogCommands(l.poll([]catch.Process{p}, []catch.Process{p}, now)); len(got) != 1 || got[0] != "7 Query" {
+		t.Errorf("a new statement wrote %v, want one Query line", got)
+	}
+}
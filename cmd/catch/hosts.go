@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hostEntry is one server to monitor, from -h or a line of -hosts-file.
+type hostEntry struct {
+	// Host is the host name or address, optionally with a port
+	Host string
+	// Alias labels the server in output instead of its address
+	Alias string
+}
+
+// hostsFlag is -h, which may be repeated to add hosts to the
+// comma-separated list.
+type hostsFlag struct{ hosts *string }
+
+func (f hostsFlag) String() string {
+	if f.hosts == nil {
+		return ""
+	}
+	return *f.hosts
+}
+
+func (f hostsFlag) Set(value string) error {
+	if *f.hosts != "" {
+		value = *f.hosts + "," + value
+	}
+	*f.hosts = value
+	return nil
+}
+
+// readHostsFile reads one "host[:port] [alias]" entry per line. Blank lines
+// and anything after a '#' are ignored.
+func readHostsFile(path string) ([]hostEntry, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []hostEntry
+	seen := map[hostEntry]bool{}
+	for i, line := range strings.Split(string(content), "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected host[:port] and an optional alias", path, i+1)
+		}
+
+		entry := hostEntry{Host: fields[0]}
+		if len(fields) == 2 {
+			entry.Alias = fields[1]
+		}
+		if seen[entry] {
+			return nil, fmt.Errorf("%s:%d: %s is listed twice", path, i+1, fields[0])
+		}
+		seen[entry] = true
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s lists no hosts", path)
+	}
+	return entries, nil
+}
+
+// reloadHosts re-reads the hosts file, starting monitors for new hosts and
+// stopping the ones for hosts no longer listed. The current hosts are kept
+// when the file can't be read.
+func (c *capture) reloadHosts(path string, build func(hostEntry) (*monitor, error)) {
+	entries, err := readHostsFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reloading hosts, keeping the current ones: %v\n", err)
+		return
+	}
+
+	listed := map[hostEntry]bool{}
+	for _, entry := range entries {
+		listed[entry] = true
+	}
+	running := map[hostEntry]*monitor{}
+	for _, m := range c.active() {
+		running[m.entry] = m
+	}
+
+	// Start new hosts first, so the capture never runs out of monitors
+	for _, entry := range entries {
+		if running[entry] != nil {
+			continue
+		}
+		m, err := build(entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding %s: %v\n", entry.Host, err)
+			continue
+		}
+		m.added = true
+		c.start(m)
+	}
+	for entry, m := range running {
+		if !listed[entry] {
+			m.remove()
+		}
+	}
+	fmt.Printf("Reloaded %s: monitoring %d hosts\n", path, len(entries))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/go-sql-driver/mysql"
+)
+
+const rdsCABundleURL = "https://truststore.pki.rds.amazonaws.com/global/global-bundle.pem"
+
+// iamSSLOptions forces verified TLS, which RDS requires for IAM
+// authentication since the token is sent as a cleartext password.
+func iamSSLOptions(ssl sslOptions) (sslOptions, error) {
+	if ssl.CA == "" {
+		return ssl, fmt.Errorf("-aws-iam-auth needs the RDS CA bundle, download %s and pass it with -ssl-ca", rdsCABundleURL)
+	}
+	switch strings.ToUpper(ssl.Mode) {
+	case "":
+		ssl.Mode = sslVerifyIdentity
+	case sslVerifyCA, sslVerifyIdentity:
+	default:
+		return ssl, fmt.Errorf("-aws-iam-auth needs -ssl-mode %s or %s", sslVerifyCA, sslVerifyIdentity)
+	}
+	return ssl, nil
+}
+
+// regionFromHost extracts the region from an RDS endpoint such as
+// mydb.abc123.us-east-1.rds.amazonaws.com.
+func regionFromHost(host string) string {
+	parts := strings.Split(host, ".")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] == "rds" {
+			return parts[i-1]
+		}
+	}
+	return ""
+}
+
+// configureIAMAuth makes every new connection authenticate with a freshly
+// generated IAM token. Tokens expire after 15 minutes, so regenerating one
+// per connection lets the pool reconnect at any point in a long run.
+func configureIAMAuth(cfg *mysql.Config, host, port, region string) error {
+	ctx := context.Background()
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("loading AWS credentials: %w", err)
+	}
+
+	if region == "" {
+		region = regionFromHost(host)
+	}
+	if region == "" {
+		region = awsCfg.Region
+	}
+	if region == "" {
+		return errors.New("cannot derive the AWS region from the host name, pass -aws-region")
+	}
+
+	endpoint := net.JoinHostPort(host, port)
+	user := cfg.User
+	buildToken := func(ctx context.Context) (string, error) {
+		return auth.BuildAuthToken(ctx, endpoint, region, user, awsCfg.Credentials)
+	}
+
+	// Fail at startup rather than on the first connection
+	if _, err := buildToken(ctx); err != nil {
+		return fmt.Errorf("generating IAM auth token: %w", err)
+	}
+
+	cfg.AllowCleartextPasswords = true
+	return cfg.Apply(mysql.BeforeConnect(func(ctx context.Context, c *mysql.Config) error {
+		token, err := buildToken(ctx)
+		if err != nil {
+			return fmt.Errorf("generating IAM auth token: %w", err)
+		}
+		c.Passwd = token
+		return nil
+	}))
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/fatih/color"
+)
+
+// killLongQueries issues KILL QUERY for every running statement older than
+// threshold seconds. Without execute it only lists what would be killed.
+// Each kill is also recorded in the capture file. server, when set, names
+// the server in messages.
+func killLongQueries(ctx context.Context, db *sql.DB, processes []catch.Process, threshold int, execute bool, writer *bufio.Writer, format, server string) {
+	red := color.New(color.FgRed, color.Bold)
+	yellow := color.New(color.FgYellow)
+
+	for _, p := range processes {
+		if p.Command != "Query" || p.Time <= threshold || catch.IsMonitoringQuery(p.Info.String) {
+			continue
+		}
+
+		summary := fmt.Sprintf("process %d (user %s, %ds): %s", p.ID, p.User, p.Time, p.Info.String)
+		if server != "" {
+			summary = fmt.Sprintf("process %d on %s (user %s, %ds): %s", p.ID, server, p.User, p.Time, p.Info.String)
+		}
+		if !execute {
+			yellow.Printf("Would kill %s (dry run, pass -yes to kill)\n", summary)
+			writer.WriteString(formatFileEvent(format, "KILL DRY-RUN", summary))
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", p.ID)); err != nil {
+			fmt.Printf("Error killing process %d: %v\n", p.ID, err)
+			continue
+		}
+		red.Printf("Killed %s\n", summary)
+		writer.WriteString(formatFileEvent(format, "KILL", summary))
+	}
+}
@@ -1,296 +1,596 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
+	"context"
 	"database/sql"
-	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/ChaosHour/go-catch/pkg/catch"
 	"github.com/fatih/color"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 const (
 	checkMark = "✓"
-)
 
-type MySQLConfig struct {
-	User     string
-	Password string
-	Host     string
-}
+	// minPollInterval keeps a typo like -s 0s from spinning the CPU
+	minPollInterval = 10 * time.Millisecond
 
-type Process struct {
-	ID      int64
-	User    string
-	Host    string
-	DB      sql.NullString
-	Command string
-	Time    int
-	State   sql.NullString
-	Info    sql.NullString
+	// proxySQLAdminPort is the default port of the ProxySQL admin interface
+	proxySQLAdminPort = 6032
+)
+
+// fatalf reports a startup error in red on stderr and exits.
+func fatalf(format string, args ...interface{}) {
+	color.New(color.FgRed).Fprintf(os.Stderr, "Error: "+format+"\n", args...)
+	os.Exit(1)
 }
 
-func readMySQLConfig() MySQLConfig {
-	home, err := os.UserHomeDir()
+// testConnection pings the server at host, reached over network, and
+// reports how the session is connected.
+func testConnection(ctx context.Context, db *sql.DB, host, network string) error {
+	err := db.PingContext(ctx)
 	if err != nil {
-		return MySQLConfig{}
+		return explainAuthError(err)
 	}
 
-	configPath := filepath.Join(home, ".my.cnf")
-	content, err := os.ReadFile(configPath)
-	if err != nil {
-		return MySQLConfig{}
+	transport := "TCP"
+	if network == "unix" {
+		transport = "unix socket"
 	}
+	green := color.New(color.FgGreen)
+	green.Printf("Connected successfully to %s (%s, %s) %s\n", host, transport, connectionTransport(ctx, db), checkMark)
+	return nil
+}
 
-	config := MySQLConfig{}
-	lines := strings.Split(string(content), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "user=") {
-			config.User = strings.TrimPrefix(line, "user=")
-		} else if strings.HasPrefix(line, "password=") {
-			config.Password = strings.TrimPrefix(line, "password=")
-		} else if strings.HasPrefix(line, "host=") {
-			config.Host = strings.TrimPrefix(line, "host=")
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
-	return config
+	return items
 }
 
-func testConnection(db *sql.DB, host string) error {
-	err := db.Ping()
-	if err != nil {
-		return err
+func main() {
+	opts := parseFlags()
+	if opts.Version {
+		fmt.Println(versionString())
+		return
+	}
+	if opts.PrintConfig {
+		if err := printConfig(os.Stdout); err != nil {
+			fatalf("%v", err)
+		}
+		return
 	}
 
-	green := color.New(color.FgGreen)
-	green.Printf("Connected successfully to %s %s\n", host, checkMark)
-	return nil
-}
+	if err := validateOutputFormat(opts.Output); err != nil {
+		fatalf("%v", err)
+	}
+	if err := validateColorMode(opts.Color); err != nil {
+		fatalf("%v", err)
+	}
+	if opts.Kill && opts.KillTime <= 0 {
+		fatalf("-kill requires a positive -kill-time")
+	}
+	replacing := 0
+	for _, given := range []bool{opts.ByUser, opts.Summary, opts.Diff, opts.Output == formatTable} {
+		if given {
+			replacing++
+		}
+	}
+	if replacing > 1 {
+		fatalf("-by-user, -summary, -diff and -o table each replace the process output, use only one of them")
+	}
+	if opts.TrackSessions {
+		if opts.Output != formatGeneralLog {
+			fatalf("-track-sessions needs -o general-log")
+		}
+		if opts.ProxySQL {
+			fatalf("-track-sessions needs idle connections, which -proxysql does not list")
+		}
+		// A connection going idle would look like it quit
+		opts.IncludeSleep = true
+	}
+	if err := validateRotateInterval(opts.RotateInterval); err != nil {
+		fatalf("%v", err)
+	}
+	if opts.Gzip {
+		if opts.CompressOutput != "" && opts.CompressOutput != compressGzip {
+			fatalf("-gzip and -compress-output %s ask for different compressions, use only one of them", opts.CompressOutput)
+		}
+		opts.CompressOutput = compressGzip
+	}
+	if err := validateCompression(opts.CompressOutput); err != nil {
+		fatalf("%v", err)
+	}
+	if opts.CompressOutput != "" && (opts.Stdout || opts.File == "-" || opts.Output == formatParquet || strings.HasPrefix(opts.Output, sqlitePrefix)) {
+		fatalf("-compress-output applies to capture files, not to stdout, -o parquet or -o sqlite")
+	}
+	if opts.Output == formatParquet {
+		if opts.Stdout || opts.File == "-" {
+			fatalf("-o parquet needs a capture file, it cannot be written to stdout")
+		}
+		if opts.RowGroupPolls < 1 {
+			fatalf("-row-group-polls must be at least 1")
+		}
+	}
+	if opts.Retention != 0 || opts.MaxTotalSize != 0 {
+		if opts.Stdout || opts.File == "-" || strings.HasPrefix(opts.Output, sqlitePrefix) {
+			fatalf("-retention and -max-total-size apply to capture files, not to stdout or -o sqlite")
+		}
+	} else if opts.RetentionDryRun {
+		fatalf("-retention-dry-run needs -retention or -max-total-size")
+	}
+	if opts.SyslogAddr != "" && !opts.Syslog {
+		fatalf("-syslog-addr needs -syslog")
+	}
+	if opts.Syslog && (opts.Stdout || opts.File != "" || opts.OutputDir != "" || opts.CompressOutput != "" ||
+		opts.Output != formatText && opts.Output != formatTable) {
+		fatalf("-syslog replaces the capture file, it cannot be used with -f, -stdout, -output-dir, -compress-output or -o other than text")
+	}
+	if opts.Quiet {
+		if opts.Stdout || opts.File == "-" {
+			fatalf("-quiet writes only the capture file, it cannot be used with -stdout")
+		}
+		if opts.Summary || opts.ByUser || opts.Diff || opts.Output == formatTable {
+			fatalf("-summary, -by-user, -diff and -o table change the terminal output, which -quiet turns off")
+		}
+	}
+	if opts.DedupInterval != 0 && !opts.Dedup {
+		fatalf("-dedup-interval needs -dedup")
+	}
+	if opts.Dedup {
+		switch {
+		case opts.Output == formatSlowLog, opts.Output == formatGeneralLog:
+			fatalf("-o %s already writes each statement once, -dedup is not needed", opts.Output)
+		case opts.Output == formatJSONSnapshot, opts.Output == formatParquet, strings.HasPrefix(opts.Output, sqlitePrefix):
+			fatalf("-dedup applies to capture files with one record per process, not -o %s", opts.Output)
+		}
+	}
+	order, err := parseSort(opts.Sort)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if opts.Top < 0 {
+		fatalf("-top must be a positive number of processes, or 0 for all")
+	}
+	passwordOptions := 0
+	for _, given := range []bool{opts.Password != "", opts.Prompt.prompt || opts.Prompt.value != "", opts.PasswordFile != "", opts.PasswordCommand != ""} {
+		if given {
+			passwordOptions++
+		}
+	}
+	if passwordOptions > 1 {
+		fatalf("-password, -p, -password-file and -password-command each give the password, use only one of them")
+	}
+	if opts.ExplainTime < 0 {
+		fatalf("-explain-time must be a positive number of seconds")
+	}
+	if opts.ProxySQL && (opts.Kill || opts.WithReplicas || opts.Blocking || opts.Repl || opts.ExplainTime > 0) {
+		fatalf("-kill, -with-replicas, -blocking, -repl and -explain-time need a MySQL server, they cannot be used with -proxysql")
+	}
+	if opts.ProxySQL && (opts.Where != "" || opts.IncludeSleep) {
+		fatalf("-where and -include-sleep change the MySQL processlist query, they cannot be used with -proxysql")
+	}
+	if opts.ProxySQL && opts.Port == 0 {
+		// The port in option files is the MySQL one, not the admin interface
+		opts.Port = proxySQLAdminPort
+	}
 
-func formatProcessOutput(p Process, useColor bool) string {
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	var match *regexp.Regexp
+	if opts.Match != "" {
+		var err error
+		if match, err = regexp.Compile(opts.Match); err != nil {
+			fatalf("invalid -match expression: %v", err)
+		}
+	}
 
-	stateColor := color.New(color.FgYellow)
-	infoColor := color.New(color.FgCyan)
-	if useColor {
-		switch {
-		case p.State.String == "login":
-			stateColor = color.New(color.FgRed)
-		case p.State.String == "Receiving from client":
-			stateColor = color.New(color.FgBlue)
-		case strings.Contains(strings.ToLower(p.Info.String), "select"):
-			if strings.Contains(strings.ToLower(p.Info.String), "count(*)") {
-				infoColor = color.New(color.FgMagenta, color.Bold)
-			} else if strings.Contains(strings.ToLower(p.Info.String), "limit") {
-				infoColor = color.New(color.FgGreen, color.Bold)
-			} else {
-				infoColor = color.New(color.FgCyan, color.Bold)
-			}
-			stateColor = color.New(color.FgGreen)
-		case strings.Contains(strings.ToLower(p.Info.String), "insert"):
-			infoColor = color.New(color.FgGreen, color.Bold)
-		case strings.Contains(strings.ToLower(p.Info.String), "update"):
-			infoColor = color.New(color.FgYellow, color.Bold)
-		case strings.Contains(strings.ToLower(p.Info.String), "delete"):
-			infoColor = color.New(color.FgRed, color.Bold)
-		case strings.Contains(strings.ToLower(p.Info.String), "create") ||
-			strings.Contains(strings.ToLower(p.Info.String), "alter") ||
-			strings.Contains(strings.ToLower(p.Info.String), "drop"):
-			infoColor = color.New(color.FgMagenta, color.Bold)
-		}
-	}
-
-	header := fmt.Sprintf("*************************** Process Info @ %s ***************************\n", timestamp)
-	info := fmt.Sprintf("       ID: %d\n"+
-		"     USER: %s\n"+
-		"     HOST: %s\n"+
-		"       DB: %s\n"+
-		"  COMMAND: %s\n"+
-		"     TIME: %d\n"+
-		"    STATE: %s\n"+
-		"     INFO: %s\n\n",
-		p.ID, p.User, p.Host, p.DB.String, p.Command, p.Time,
-		stateColor.SprintFunc()(p.State.String),
-		infoColor.SprintFunc()(p.Info.String))
-
-	return header + info
-}
+	// Read MySQL config, unless a full DSN replaces it
+	var config MySQLConfig
+	if opts.DSN == "" || opts.PrintDefaults {
+		var groups []string
+		var err error
+		if config, groups, err = loadOptionFiles(opts); err != nil {
+			fatalf("%v", err)
+		}
+		if opts.PrintDefaults {
+			printDefaults(os.Stdout, config, groups)
+			return
+		}
+	}
 
-func isMonitoringQuery(info string) bool {
-	// Check if this is our own monitoring query
-	return strings.Contains(info, "FROM information_schema.processlist") &&
-		strings.Contains(info, "WHERE command != 'Sleep'")
-}
+	// -dsn names a single server; otherwise -h or -hosts-file may list several
+	entries := []hostEntry{{Host: opts.Host}}
+	switch {
+	case opts.HostsFile != "":
+		if opts.Host != "" || opts.DSN != "" {
+			fatalf("-hosts-file replaces -h and -dsn, use only one of them")
+		}
+		var err error
+		if entries, err = readHostsFile(opts.HostsFile); err != nil {
+			fatalf("%v", err)
+		}
+	case opts.DSN == "" && len(splitList(opts.Host)) > 1:
+		entries = nil
+		for _, host := range splitList(opts.Host) {
+			entries = append(entries, hostEntry{Host: host})
+		}
+	}
+	// A hosts file may grow on reload and replicas are added as they are
+	// found, so their output is always labeled
+	multi := len(entries) > 1 || opts.HostsFile != "" || opts.WithReplicas
+	if multi && opts.SummaryRefresh {
+		fatalf("-summary-refresh repaints the screen for a single host, it cannot be used with several hosts")
+	}
 
-func main() {
-	hostFlag := flag.String("h", "", "MySQL host address")
-	fileFlag := flag.String("f", "", "Output file name (without date)")
-	sleepFlag := flag.Int("s", 1, "Sleep duration in nanoseconds (default: 1)")
-	queryFlag := flag.Bool("q", false, "Show only queries (SELECT statements)")
-	debugFlag := flag.Bool("d", false, "Debug mode - show all queries with timing")
-	verboseFlag := flag.Bool("v", false, "Verbose debug mode")
-	flag.Parse()
-
-	// Read MySQL config
-	config := readMySQLConfig()
-
-	// Determine host
-	host := *hostFlag
-	if host == "" {
-		if config.Host != "" {
-			host = config.Host
+	// Prompt once, not for every host
+	if opts.DSN == "" && opts.Prompt.prompt {
+		password, err := promptPassword()
+		if err != nil {
+			fatalf("%v", err)
+		}
+		opts.Prompt = promptPasswordFlag{value: password}
+	}
+	// Likewise the password file and command are read once
+	if opts.DSN == "" && (opts.PasswordFile != "" || opts.PasswordCommand != "") {
+		var password string
+		var err error
+		if opts.PasswordFile != "" {
+			password, err = readPasswordFile(opts.PasswordFile)
 		} else {
-			host = "localhost"
+			password, err = runPasswordCommand(opts.PasswordCommand)
+		}
+		if err != nil {
+			fatalf("%v", err)
 		}
+		opts.Password = password
 	}
 
-	// Build DSN
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:3306)/",
-		config.User,
-		config.Password,
-		host,
-	)
+	interval := opts.Interval
+	if interval < minPollInterval {
+		interval = minPollInterval
+	}
 
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		panic(err)
+	// Cancelled on shutdown, which also interrupts queries in flight
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Capture files are named after -f in the output directory, checked
+	// before connecting
+	var outputMessage string
+	if !opts.Stdout && opts.File != "-" && !opts.Syslog {
+		if err := validateFileBase(opts.File); err != nil {
+			fatalf("%v", err)
+		}
+		dir, err := prepareOutputDir(opts.OutputDir)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if path, ok := strings.CutPrefix(opts.Output, sqlitePrefix); ok {
+			if !filepath.IsAbs(path) {
+				opts.Output = sqlitePrefix + filepath.Join(dir, path)
+			}
+			outputMessage = "Storing processes in " + strings.TrimPrefix(opts.Output, sqlitePrefix)
+		} else {
+			opts.File = filepath.Join(dir, cmp.Or(opts.File, "load_test"))
+			outputMessage = "Writing capture files to " + captureFilePattern(opts, opts.File, multi)
+		}
 	}
-	defer db.Close()
 
-	// Test connection and show status
-	if err := testConnection(db, host); err != nil {
-		panic(fmt.Sprintf("Failed to connect to %s: %v", host, err))
+	c := &capture{
+		ctx:      ctx,
+		opts:     opts,
+		format:   fileFormat(opts.Output),
+		snapshot: opts.Output == formatJSONSnapshot,
+		parquet:  opts.Output == formatParquet,
+		interval: interval,
+		order:    order,
+		filter: processFilter{
+			Users:        newSet(splitList(opts.UserFilter)),
+			ExcludeUsers: newSet(splitList(opts.ExcludeUsers)),
+			DB:           opts.DBFilter,
+			MinTime:      opts.MinTime,
+			Match:        match,
+			Blocked:      opts.Locks,
+		},
+		query: catch.QueryOptions{
+			IncludeSleep: opts.IncludeSleep,
+			Where:        opts.Where,
+			// -d lists the tool's own query too
+			ExcludeSelf: !opts.ShowSelf && !opts.Debug,
+		},
+		multi:     multi,
+		stdout:    opts.Stdout || opts.File == "-",
+		retention: newRetention(opts, opts.Output == formatParquet, multi && !opts.MergeOutput),
 	}
 
-	// Add debug counter
-	queryCount := 0
-	lastCheck := time.Now()
+	if opts.Webhook != "" || opts.SlackWebhook != "" || opts.AlertTime != 0 {
+		if opts.Webhook == "" && opts.SlackWebhook == "" || opts.AlertTime <= 0 {
+			fatalf("-webhook or -slack-webhook and a positive -alert-time are needed together")
+		}
+		alerts, err := newAlerter(opts.Webhook, opts.SlackWebhook, opts.AlertTime)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		c.alerts = alerts
+	}
+	if opts.Syslog {
+		sink, err := openSyslog(opts.SyslogAddr)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		c.syslog = sink
+	}
+	if path, ok := strings.CutPrefix(opts.Output, sqlitePrefix); ok {
+		store, err := openSQLiteStore(path)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		c.database = store
+	}
 
-	for {
-		// Determine filename
-		var filename string
-		date := time.Now().Format("2006-01-02")
-		if *fileFlag != "" {
-			filename = *fileFlag + "-" + date + ".txt"
-		} else {
-			filename = "load_test-" + date + ".txt"
+	if opts.StoreDSN != "" {
+		ctx, cancel := c.connectContext()
+		store, err := openMySQLStore(ctx, opts.StoreDSN, opts.StoreTable, opts)
+		cancel()
+		if err != nil {
+			fatalf("%v", err)
 		}
+		c.store = store
+	}
 
-		file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if c.stdout && c.format != formatText {
+		// stdout carries only the records, every message goes to stderr
+		c.records = os.Stdout
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+	}
+	if opts.Quiet {
+		// Only the capture file gets the processes, and every message
+		// goes to stderr
+		os.Stdout = os.Stderr
+		color.Output = os.Stderr
+	}
+	// Decided after the redirect, so piping the records keeps the terminal colored
+	color.NoColor = !colorEnabled(opts.Color, os.Stdout)
+	if opts.Verbose {
+		fmt.Println(versionString())
+	}
+
+	// build creates the monitor for one host, sharing every other setting
+	build := func(entry hostEntry) (*monitor, error) {
+		hostOpts := *opts
+		hostOpts.Host = entry.Host
+		driverConfig, addr, err := resolveDriverConfig(&hostOpts, config)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 
-		// Use buffered writer for better performance
-		writer := bufio.NewWriter(file)
+		applyTimeouts(driverConfig, opts.ConnectTimeout, opts.ReadTimeout, opts.WriteTimeout)
 
-		// Query and write process list
-		processes, err := getProcessList(db)
+		connector, err := mysql.NewConnector(driverConfig)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			file.Close()
-			continue
-		}
-
-		// Write each process to file
-		for _, p := range processes {
-			info := p.Info.String
-			isQuery := strings.Contains(info, "select") ||
-				strings.Contains(info, "insert") ||
-				strings.Contains(info, "update") ||
-				strings.Contains(info, "delete") ||
-				strings.Contains(info, "create") ||
-				strings.Contains(info, "alter") ||
-				strings.Contains(info, "drop")
-
-			// Skip our own monitoring query unless in debug mode
-			if !*debugFlag && isMonitoringQuery(p.Info.String) {
-				continue
-			}
+			return nil, err
+		}
+		return newMonitor(c, entry, addr, driverConfig, connector), nil
+	}
 
-			// Enhanced query detection
-			if *queryFlag && !isQuery {
-				continue
-			}
+	var monitors []*monitor
+	for _, entry := range entries {
+		m, err := build(entry)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		monitors = append(monitors, m)
+	}
+	if opts.Verbose {
+		fmt.Printf("Connection pool: max-open-conns=%d max-idle-conns=%d conn-max-lifetime=%s\n",
+			opts.MaxOpenConns, opts.MaxIdleConns, opts.ConnMaxLifetime)
+	}
 
-			if *verboseFlag {
-				queryType := "unknown"
-				if strings.Contains(strings.ToLower(info), "select") {
-					queryType = "SELECT"
-				} else if strings.Contains(strings.ToLower(info), "show") {
-					queryType = "SHOW"
+	// With a single host a failed connection is fatal. With several, the
+	// others keep capturing while the failed one reconnects in run.
+	if !multi {
+		m := monitors[0]
+		if err := m.connect(); err != nil {
+			fatalf("Failed to connect to %s as %s: %v", m.name, m.cfg.User, err)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for _, m := range monitors {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := m.connect(); err != nil {
+					color.New(color.FgRed).Fprintf(os.Stderr, "Error: Failed to connect to %s as %s: %v\n",
+						m.name, m.cfg.User, err)
 				}
+			}()
+		}
+		wg.Wait()
+	}
 
-				fmt.Printf("Debug: Found %s query - State: %s, Time: %d, Info: %.100s...\n",
-					queryType, p.State.String, p.Time, info)
-			}
+	if outputMessage != "" {
+		fmt.Println(outputMessage)
+	}
+	if !opts.Once {
+		fmt.Printf("Polling every %s\n", interval)
+	}
 
-			if *debugFlag && (strings.Contains(info, "select") || strings.Contains(info, "count(") ||
-				strings.Contains(info, "limit")) {
-				queryCount++
-				fmt.Printf("Debug: Query #%d detected: %.100s...\nState: %s, Time: %d\n\n",
-					queryCount, p.Info.String, p.State.String, p.Time)
-			}
+	if opts.MetricsAddr != "" {
+		stats, err := startMetrics(opts.MetricsAddr)
+		if err != nil {
+			fatalf("cannot serve metrics on %s: %v", opts.MetricsAddr, err)
+		}
+		c.stats = stats
+		fmt.Printf("Serving metrics on http://%s/metrics\n", opts.MetricsAddr)
+	}
+
+	// Stop cleanly on Ctrl-C or SIGTERM
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// A nil channel never fires, so without -duration the run is unbounded
+	var deadline <-chan time.Time
+	if opts.Duration > 0 {
+		deadline = time.After(opts.Duration)
+	}
+
+	// SIGHUP re-reads the hosts file
+	reload := make(chan os.Signal, 1)
+	if opts.HostsFile != "" {
+		signal.Notify(reload, syscall.SIGHUP)
+	}
 
-			// Write to file without colors
-			fileOutput := formatProcessOutput(p, false)
-			_, err := writer.WriteString(fileOutput)
-			if err != nil {
-				fmt.Printf("Error writing to file: %v\n", err)
+	go func() {
+		for {
+			select {
+			case sig := <-stop:
+				fmt.Printf("\nReceived %s, shutting down\n", sig)
+			case <-deadline:
+				fmt.Printf("\nRan for %s, stopping\n", opts.Duration)
+			case <-reload:
+				c.reloadHosts(opts.HostsFile, build)
 				continue
 			}
-
-			// Print to terminal with colors
-			fmt.Print(formatProcessOutput(p, true))
+			c.mu.Lock()
+			cancel()
+			c.mu.Unlock()
+			return
 		}
-
-		// Print stats every 5 seconds in debug mode
-		if *debugFlag && time.Since(lastCheck) > 5*time.Second {
-			fmt.Printf("Stats: Captured %d queries in last 5 seconds\n", queryCount)
-			queryCount = 0
-			lastCheck = time.Now()
+	}()
+
+	// Print stats every 5 seconds in debug mode, and every minute with
+	// -quiet so the log shows the capture is alive
+	if opts.Debug || opts.Quiet {
+		statsInterval := time.Minute
+		if opts.Debug {
+			statsInterval = 5 * time.Second
 		}
+		go func() {
+			ticker := time.NewTicker(statsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					c.print(statsLine(c.active(), multi, c.store, statsInterval, opts.Debug))
+				}
+			}
+		}()
+	}
 
-		// Flush the buffer to ensure all data is written
-		writer.Flush()
-		file.Close()
+	// Without a file there is only one CSV stream, and one header
+	if c.stdout && c.format == formatCSV {
+		header, err := fileHeader(c.format, opts.CSVNoHeader)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		c.writeRecords(header)
+	}
 
-		// Use nanosecond sleep duration
-		time.Sleep(time.Duration(*sleepFlag) * time.Nanosecond)
+	started := time.Now()
+	for _, m := range monitors {
+		c.start(m)
+	}
+	if opts.WithReplicas {
+		go c.watchReplicas(monitors, build)
+	}
+	c.wg.Wait()
+
+	elapsed := time.Since(started).Round(time.Second)
+	failed := false
+	total := 0
+	for _, m := range c.all() {
+		fmt.Printf("%sCaptured %d processes in %d polls over %s\n", m.prefix(), m.captured, m.polls, elapsed)
+		total += m.captured
+		failed = failed || m.failed
+		m.db.Close()
+		closeCaptureFiles(m.parquetFile, m.compressedFile)
+	}
+	closeCaptureFiles(c.parquetFile, c.compressedFile)
+	if multi {
+		fmt.Printf("Captured %d processes from %d hosts over %s\n", total, len(c.all()), elapsed)
+	}
+	if c.database != nil {
+		c.database.Close()
+	}
+	if c.syslog != nil {
+		c.syslog.Close()
+	}
+	if c.store != nil {
+		if dropped := c.store.Close(); dropped > 0 {
+			color.New(color.FgRed, color.Bold).Fprintf(os.Stderr, "Warning: %d captured rows could not be stored\n", dropped)
+		}
+	}
+	if c.alerts != nil {
+		// Let the last alerts go out
+		c.alerts.wait()
+	}
+	if failed {
+		os.Exit(1)
 	}
 }
 
-// Remove currentUser parameter since it's no longer used
-func getProcessList(db *sql.DB) ([]Process, error) {
-	query := `SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO 
-			 FROM information_schema.processlist 
-			 WHERE command != 'Sleep'
-			 AND (COMMAND = 'Query' 
-				  OR INFO IS NOT NULL
-				  OR STATE NOT IN ('', 'init', 'after create', 'CONNECTING')
-				  OR TIME > 0)
-			 ORDER BY TIME DESC`
-
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, err
+// closeCaptureFiles closes the capture files kept open between polls,
+// either of which may be nil, writing out what they still hold.
+func closeCaptureFiles(parquet *parquetFile, compressed *compressedFile) {
+	if parquet != nil {
+		if err := parquet.Close(); err != nil {
+			fatalf("%v", err)
+		}
 	}
-	defer rows.Close()
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			fatalf("%v", err)
+		}
+	}
+}
 
-	var processes []Process
-	for rows.Next() {
-		var p Process
-		err := rows.Scan(&p.ID, &p.User, &p.Host, &p.DB, &p.Command, &p.Time, &p.State, &p.Info)
-		if err != nil {
-			return nil, err
+// statsLine reports the processes captured in the interval since the
+// last call and, in debug mode, the SELECTs among them, with several hosts
+// the connection state of each, the capture files being written and the
+// bytes written to them, and with -store-dsn the rows queued and dropped.
+func statsLine(monitors []*monitor, multi bool, store *mysqlStore, interval time.Duration, debug bool) string {
+	var captured, count, written int64
+	var states, files []string
+	for _, m := range monitors {
+		captured += m.statsCaptured.Swap(0)
+		count += m.queryCount.Swap(0)
+		states = append(states, fmt.Sprintf("%s %s", m.name, m.state.Load()))
+		written += m.fileBytes.Load()
+		// With -merge-output the monitors share one file
+		if file, ok := m.file.Load().(string); ok && !slices.Contains(files, file) {
+			files = append(files, file)
 		}
-		processes = append(processes, p)
 	}
-	return processes, nil
+	line := fmt.Sprintf("Stats: Captured %d processes in the last %s (%.1f/s)", captured, interval, float64(captured)/interval.Seconds())
+	if debug {
+		line += fmt.Sprintf(", %d SELECT queries", count)
+	}
+	if multi {
+		line += " (" + strings.Join(states, ", ") + ")"
+	}
+	if len(files) > 0 {
+		line += fmt.Sprintf(", writing %s, %s written", strings.Join(files, ", "), formatSize(written))
+	}
+	if store != nil {
+		line += ", " + store.stats()
+	}
+	return line + "\n"
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeOptionFile writes content to name under dir and returns its path.
+func writeOptionFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withoutGlobalOptionFiles keeps /etc/my.cnf and the like out of a test.
+func withoutGlobalOptionFiles(t *testing.T) {
+	t.Helper()
+	saved := globalOptionFiles
+	globalOptionFiles = nil
+	t.Cleanup(func() { globalOptionFiles = saved })
+}
+
+func TestReadMySQLConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		groups  []string
+		want    MySQLConfig
+	}{
+		{
+			name:    "client group",
+			content: "[client]\nuser=app\npassword=secret\nhost=db1\nport=3307\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "app", Password: "secret", Host: "db1", Port: "3307"},
+		},
+		{
+			name:    "spaces around keys and values",
+			content: "  [ client ]  \n  user   =   app  \n\tpassword\t=\tsecret\t\nhost= db1\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "app", Password: "secret", Host: "db1"},
+		},
+		{
+			name:    "later groups override earlier ones",
+			content: "[mysql]\nuser=override\n[client]\nuser=app\nhost=db1\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "override", Host: "db1"},
+		},
+		{
+			name:    "keys before any group apply to all",
+			content: "user=global\n[client]\nhost=db1\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "global", Host: "db1"},
+		},
+		{
+			name:    "other groups are ignored",
+			content: "[mysqldump]\nuser=dump\n[client]\nuser=app\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "app"},
+		},
+		{
+			name:    "section names are case-insensitive",
+			content: "[Client]\nUser=app\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "app"},
+		},
+		{
+			name:    "comments and blank lines",
+			content: "# comment\n; also a comment\n\n[client]\nuser=app # trailing comment\npassword=\"p#ss\" # quoted\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "app", Password: "p#ss"},
+		},
+		{
+			name:    "quoted values",
+			content: "[client]\npassword='it''s'\nhost=\"db 1\"\nsocket='/tmp/my sql.sock'\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{Password: "it", Host: "db 1", Socket: "/tmp/my sql.sock"},
+		},
+		{
+			name:    "underscores and dashes are the same",
+			content: "[client]\nssl_mode=REQUIRED\ndefault_character_set=latin1\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{SSLMode: "REQUIRED", Charset: "latin1"},
+		},
+		{
+			name:    "bare boolean options",
+			content: "[client]\ncompress\nenable-cleartext-plugin\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{Compress: true, EnableCleartextPlugin: true},
+		},
+		{
+			name:    "malformed lines are skipped",
+			content: "[client]\n= value without a key\n[unclosed\nuser=app\n==\nhost=db1\n",
+			groups:  defaultOptionGroups,
+			want:    MySQLConfig{User: "app", Host: "db1"},
+		},
+		{
+			name:    "group suffix",
+			content: "[client]\nuser=app\n[client_test]\nuser=tester\n",
+			groups:  withGroupSuffix(defaultOptionGroups, "_test"),
+			want:    MySQLConfig{User: "tester"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeOptionFile(t, t.TempDir(), "my.cnf", tt.content)
+			got, err := readMySQLConfig(optionSource{DefaultsFile: path}, tt.groups)
+			if err != nil {
+				t.Fatalf("readMySQLConfig: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadMySQLConfigFiles(t *testing.T) {
+	withoutGlobalOptionFiles(t)
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.cnf")
+
+	t.Run("missing defaults file", func(t *testing.T) {
+		_, err := readMySQLConfig(optionSource{DefaultsFile: missing}, defaultOptionGroups)
+		if err == nil || !strings.Contains(err.Error(), "defaults file") {
+			t.Errorf("got error %v, want a defaults file error", err)
+		}
+	})
+
+	t.Run("missing defaults extra file", func(t *testing.T) {
+		_, err := readMySQLConfig(optionSource{DefaultsExtraFile: missing}, defaultOptionGroups)
+		if err == nil || !strings.Contains(err.Error(), "defaults extra file") {
+			t.Errorf("got error %v, want a defaults extra file error", err)
+		}
+	})
+
+	t.Run("missing user file is skipped", func(t *testing.T) {
+		got, err := readMySQLConfig(optionSource{UserFile: missing}, defaultOptionGroups)
+		if err != nil {
+			t.Fatalf("readMySQLConfig: %v", err)
+		}
+		if got != (MySQLConfig{}) {
+			t.Errorf("got %+v, want no options", got)
+		}
+	})
+
+	t.Run("user file overrides extra file", func(t *testing.T) {
+		extra := writeOptionFile(t, dir, "extra.cnf", "[client]\nuser=extra\nhost=db1\n")
+		user := writeOptionFile(t, dir, "user.cnf", "[client]\nuser=mine\n")
+		got, err := readMySQLConfig(optionSource{DefaultsExtraFile: extra, UserFile: user}, defaultOptionGroups)
+		if err != nil {
+			t.Fatalf("readMySQLConfig: %v", err)
+		}
+		if want := (MySQLConfig{User: "mine", Host: "db1"}); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("a later file wins whatever the group", func(t *testing.T) {
+		system := writeOptionFile(t, dir, "etc/my.cnf", "[mysql]\nuser=sysuser\npassword=system\n[client]\nhost=db1\n")
+		user := writeOptionFile(t, dir, "home/.my.cnf", "[client]\npassword=mine\n[mysql]\nhost=db2\n")
+		globalOptionFiles = []string{system}
+		defer func() { globalOptionFiles = nil }()
+
+		got, err := readMySQLConfig(optionSource{UserFile: user}, defaultOptionGroups)
+		if err != nil {
+			t.Fatalf("readMySQLConfig: %v", err)
+		}
+		if want := (MySQLConfig{User: "sysuser", Password: "mine", Host: "db2"}); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("defaults file replaces the others", func(t *testing.T) {
+		defaults := writeOptionFile(t, dir, "defaults.cnf", "[client]\nhost=db2\n")
+		user := writeOptionFile(t, dir, "user2.cnf", "[client]\nuser=mine\n")
+		got, err := readMySQLConfig(optionSource{DefaultsFile: defaults, UserFile: user}, defaultOptionGroups)
+		if err != nil {
+			t.Fatalf("readMySQLConfig: %v", err)
+		}
+		if want := (MySQLConfig{Host: "db2"}); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestReadMySQLConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeOptionFile(t, dir, "included.cnf", "[client]\nuser=included\npassword=secret\n")
+	writeOptionFile(t, dir, "conf.d/a.cnf", "[client]\nhost=db1\n")
+	writeOptionFile(t, dir, "conf.d/b.cnf", "[client]\nhost=db2\n")
+	writeOptionFile(t, dir, "conf.d/ignored.txt", "[client]\nhost=ignored\n")
+	main := writeOptionFile(t, dir, "my.cnf", "[client]\nuser=main\n!include included.cnf\n!includedir conf.d\nport=3307\n")
+
+	got, err := readMySQLConfig(optionSource{DefaultsFile: main}, defaultOptionGroups)
+	if err != nil {
+		t.Fatalf("readMySQLConfig: %v", err)
+	}
+	// Included values override earlier lines, and .cnf files are read in name order
+	if want := (MySQLConfig{User: "included", Password: "secret", Host: "db2", Port: "3307"}); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	t.Run("include loop", func(t *testing.T) {
+		loop := writeOptionFile(t, dir, "loop.cnf", "!include loop.cnf\n")
+		if _, err := readMySQLConfig(optionSource{DefaultsFile: loop}, defaultOptionGroups); err == nil {
+			t.Error("got no error for an include loop")
+		}
+	})
+
+	t.Run("missing include", func(t *testing.T) {
+		broken := writeOptionFile(t, dir, "broken.cnf", "!include nowhere.cnf\n")
+		if _, err := readMySQLConfig(optionSource{DefaultsFile: broken}, defaultOptionGroups); err == nil {
+			t.Error("got no error for a missing include")
+		}
+	})
+}
+
+func TestParseOptionValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"secret", "secret"},
+		{"  secret  ", "secret"},
+		{"two words", "two words"},
+		{"secret # comment", "secret"},
+		{"secret#comment", "secret"},
+		{"# only a comment", ""},
+		{`"p#ss"`, "p#ss"},
+		{`'p#ss'`, "p#ss"},
+		{`"p#ss" # comment`, "p#ss"},
+		{`"secret"trailing`, "secret"},
+		{`"it's"`, "it's"},
+		{`'say "hi"'`, `say "hi"`},
+		{`"a\"b"`, `a"b`},
+		{`'a\'b'`, "a'b"},
+		{`"a\\b"`, `a\b`},
+		{`"a\nb\tc\sd"`, "a\nb\tc d"},
+		{`"\x"`, "x"},
+		{`"  spaced  "`, "  spaced  "},
+		{`""`, ""},
+		{`"unbalanced`, "unbalanced"},
+		{`'unbalanced # not a comment`, "unbalanced # not a comment"},
+		{`"ends in backslash\`, `ends in backslash\`},
+		{`unquoted"quote`, `unquoted"quote`},
+		{`C:\path\to`, `C:\path\to`},
+	}
+	for _, tt := range tests {
+		if got := parseOptionValue(tt.raw); got != tt.want {
+			t.Errorf("parseOptionValue(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
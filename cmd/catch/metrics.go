@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics exposes what each poll sees for Prometheus to scrape, labeled
+// by the monitored server.
+type metrics struct {
+	active  *prometheus.GaugeVec
+	time    *prometheus.HistogramVec
+	queries *prometheus.CounterVec
+
+	mu sync.Mutex
+	// statements seen in each server's previous poll, so the counters only
+	// count each running statement once
+	seen map[string]map[statementKey]bool
+}
+
+// statementKey identifies a statement across polls: the same connection
+// running the same text.
+type statementKey struct {
+	id   int64
+	info string
+}
+
+// startMetrics registers the metrics and serves them on addr at /metrics.
+// It fails when addr can't be listened on, such as when the port is taken.
+func startMetrics(addr string) (*metrics, error) {
+	m := &metrics{
+		active: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "catch_active_processes",
+			Help: "Number of non-Sleep processes in the last poll.",
+		}, []string{"server"}),
+		time: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "catch_process_time_seconds",
+			Help:    "TIME of each active process, observed every poll.",
+			Buckets: []float64{1, 2, 5, 10, 30, 60, 300, 900, 3600},
+		}, []string{"server"}),
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "catch_queries_total",
+			Help: "Statements seen running, by statement type.",
+		}, []string{"server", "type"}),
+		seen: map[string]map[statementKey]bool{},
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.active, m.time, m.queries)
+
+	// Listen before returning, so a taken port fails at startup
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving metrics on %s: %v\n", addr, err)
+		}
+	}()
+	return m, nil
+}
+
+// update records one poll's process list from server.
+func (m *metrics) update(server string, processes []catch.Process) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[statementKey]bool, len(processes))
+	active := 0
+	for _, p := range processes {
+		if catch.IsMonitoringQuery(p.Info.String) {
+			continue
+		}
+		active++
+		m.time.WithLabelValues(server).Observe(float64(p.Time))
+
+		if !p.Info.Valid {
+			continue
+		}
+		key := statementKey{p.ID, p.Info.String}
+		seen[key] = true
+		if !m.seen[server][key] {
+			m.queries.WithLabelValues(server, catch.ClassifyQuery(p.Info.String).String()).Inc()
+		}
+	}
+	m.seen[server] = seen
+	m.active.WithLabelValues(server).Set(float64(active))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestStartMetrics(t *testing.T) {
+	// Find a free port, then give it to startMetrics
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	if _, err := startMetrics(addr); err != nil {
+		t.Fatalf("startMetrics(%s): %v", addr, err)
+	}
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /metrics answered %s", resp.Status)
+	}
+
+	// The port is taken now
+	if _, err := startMetrics(addr); err == nil {
+		t.Errorf("startMetrics(%s) succeeded on a port in use", addr)
+	}
+}
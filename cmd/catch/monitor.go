@@ -0,0 +1,1099 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/fatih/color"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Connection states of a monitored server, shown in the debug stats line
+const (
+	stateConnecting   = "connecting"
+	stateConnected    = "connected"
+	stateReconnecting = "reconnecting"
+	stateDown         = "down"
+	stateRemoved      = "removed"
+)
+
+// serverCheckInterval is how often the server identity is read again, to
+// notice a failover behind the same address
+const serverCheckInterval = 10 * time.Second
+
+// capture is the state shared by the monitors of one run.
+type capture struct {
+	opts *options
+	// format is the capture file format
+	format string
+	// snapshot writes JSON as one document per poll, for -o json-snapshot
+	snapshot bool
+	// database replaces the capture file with -o sqlite:<path>
+	database *sqliteStore
+	// parquet writes the capture files as Parquet, for -o parquet, and
+	// parquetFile is the file all hosts share with -merge-output
+	parquet     bool
+	parquetFile *parquetFile
+	// compressedFile is the -compress-output file all hosts share with
+	// -merge-output
+	compressedFile *compressedFile
+	// syslog replaces the capture file with -syslog
+	syslog *syslogSink
+	// store also receives the processes with -store-dsn
+	store *mysqlStore
+	// alerts posts the processes running longer than -alert-time
+	alerts *alerter
+	// retention deletes old capture files, for -retention and
+	// -max-total-size
+	retention *retention
+	interval  time.Duration
+	filter    processFilter
+	// order sorts the processes of each poll, for -sort
+	order processOrder
+	stats *metrics
+	// query widens or narrows the processlist query itself
+	query catch.QueryOptions
+	// multi is set when several servers are monitored, so output is
+	// labeled with the server each process came from
+	multi bool
+	// stdout replaces the capture file with standard output, for -f - and
+	// -stdout
+	stdout bool
+	// records receives JSON and CSV records written to stdout
+	records io.Writer
+	// ctx is cancelled to stop every monitor, interrupting their queries
+	ctx context.Context
+
+	termMu sync.Mutex // keeps the output of different servers apart
+	fileMu sync.Mutex // guards the shared file of -merge-output
+
+	mu sync.Mutex
+	// monitors lists every monitor started, including removed ones
+	monitors []*monitor
+	wg       sync.WaitGroup
+}
+
+// connectContext bounds the checks made when connecting by -connect-timeout.
+func (c *capture) connectContext() (context.Context, context.CancelFunc) {
+	return withTimeout(c.ctx, c.opts.ConnectTimeout)
+}
+
+// queryContext bounds one poll's queries by -read-timeout.
+func (c *capture) queryContext() (context.Context, context.CancelFunc) {
+	return withTimeout(c.ctx, c.opts.ReadTimeout)
+}
+
+// withTimeout is context.WithTimeout, except that a zero timeout, which
+// disables the driver's timeouts, leaves ctx unbounded too.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// start runs m in the background, connecting first unless it already is.
+func (c *capture) start(m *monitor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.ctx.Done():
+		// Shutting down, a reload came in too late
+		return
+	default:
+	}
+	c.monitors = append(c.monitors, m)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		if m.db == nil {
+			if err := m.connect(); err != nil {
+				color.New(color.FgRed).Fprintf(os.Stderr, "Error: Failed to connect to %s as %s: %v\n",
+					m.name, m.cfg.User, err)
+			}
+		}
+		if m.added && m.state.Load() == stateConnected {
+			m.writeFile([]byte(m.fileEvent("CONNECTED", fmt.Sprintf("started monitoring %s", m.name))))
+		}
+		m.run()
+
+		if m.removed.Load() {
+			m.writeFile([]byte(m.fileEvent("DISCONNECTED", fmt.Sprintf("stopped monitoring %s", m.name))))
+			fmt.Printf("%sStopped monitoring, removed from the hosts file\n", m.prefix())
+			m.db.Close()
+		}
+	}()
+}
+
+// all returns every monitor started so far.
+func (c *capture) all() []*monitor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*monitor(nil), c.monitors...)
+}
+
+// active returns the monitors that haven't been removed.
+func (c *capture) active() []*monitor {
+	var active []*monitor
+	for _, m := range c.all() {
+		if !m.removed.Load() {
+			active = append(active, m)
+		}
+	}
+	return active
+}
+
+// shared reports whether all servers write to the same output.
+func (c *capture) shared() bool {
+	return c.opts.MergeOutput || c.stdout
+}
+
+// writeRecords writes s to the stdout record stream in one piece.
+func (c *capture) writeRecords(s string) {
+	c.termMu.Lock()
+	defer c.termMu.Unlock()
+	io.WriteString(c.records, s)
+}
+
+// print writes s to the terminal in one piece.
+func (c *capture) print(s string) {
+	c.termMu.Lock()
+	defer c.termMu.Unlock()
+	fmt.Print(s)
+}
+
+// monitor polls the processlist of one server.
+type monitor struct {
+	c     *capture
+	entry hostEntry
+	name  string // alias or address of the server, labels its output
+	cfg   *mysql.Config
+	open  func() *sql.DB
+	// db is replaced when reconnecting
+	db *sql.DB
+	// server is the detected flavor and version, zero when unknown
+	server catch.ServerInfo
+	// serverFile is the capture file the server was last recorded in
+	serverFile string
+	// serverChecked is when the server identity was last read, and
+	// serverStale is set by reconnecting to read it again on the next poll
+	serverChecked time.Time
+	serverStale   bool
+
+	// stop is closed by remove
+	stop    chan struct{}
+	removed atomic.Bool
+	// added is set for hosts added after startup, by reloading the hosts
+	// file or discovering a replica
+	added bool
+
+	state      atomic.Value // one of the state constants
+	queryCount atomic.Int64 // SELECTs counted in debug mode since the last stats line
+	// statsCaptured counts the processes captured since the last stats line
+	statsCaptured atomic.Int64
+
+	// lastFile is the capture file this monitor last wrote to, file the
+	// same for the stats line, and fileBytes counts what it has written
+	lastFile  string
+	file      atomic.Value
+	fileBytes atomic.Int64
+	// fileSeq is the -max-size sequence number of the current capture
+	// file named after fileBase
+	fileSeq  int
+	fileBase string
+
+	polls    int
+	captured int
+	// failed is set when a -once poll could not read the processlist
+	failed bool
+	// lockWaitsFailed is set once -blocking couldn't read the lock waits,
+	// so the warning isn't repeated every poll
+	lockWaitsFailed bool
+	// replicationNoted is set once -repl reported that it has nothing to
+	// show, for the same reason
+	replicationNoted bool
+	// slowLog holds the running statements of -o slowlog, nil otherwise
+	slowLog *slowLog
+	// generalLog holds the statements and sessions of -o general-log, nil
+	// otherwise
+	generalLog *generalLog
+	// alerted lists the process IDs alerted on that are still running, so
+	// each is alerted on once
+	alerted map[int64]bool
+	// previous holds the processes of the last poll by ID, for -diff
+	previous map[int64]catch.Process
+	// explained lists the statements still running whose plan was
+	// captured, so each is explained once
+	explained map[statementKey]bool
+	// parquetFile is the open -o parquet capture file of this server, and
+	// compressedFile the open -compress-output one
+	parquetFile    *parquetFile
+	compressedFile *compressedFile
+	// written holds, with -dedup, when each statement of the previous poll
+	// was last written to the capture file
+	written map[statementKey]time.Time
+}
+
+// newMonitor creates the monitor for entry, naming it addr unless entry has
+// an alias.
+func newMonitor(c *capture, entry hostEntry, addr string, cfg *mysql.Config, connector driver.Connector) *monitor {
+	name := addr
+	if entry.Alias != "" {
+		name = entry.Alias
+	}
+	m := &monitor{c: c, entry: entry, name: name, cfg: cfg, stop: make(chan struct{})}
+	switch c.format {
+	case formatSlowLog:
+		m.slowLog = newSlowLog()
+	case formatGeneralLog:
+		m.generalLog = newGeneralLog(c.opts.TrackSessions)
+	}
+	m.open = func() *sql.DB {
+		db := sql.OpenDB(connector)
+		db.SetMaxOpenConns(c.opts.MaxOpenConns)
+		db.SetMaxIdleConns(c.opts.MaxIdleConns)
+		db.SetConnMaxLifetime(c.opts.ConnMaxLifetime)
+		return db
+	}
+	m.state.Store(stateConnecting)
+	return m
+}
+
+// sleep waits for d and reports false once the capture is stopped or the
+// monitor removed.
+func (m *monitor) sleep(d time.Duration) bool {
+	select {
+	case <-m.c.ctx.Done():
+		return false
+	case <-m.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// remove stops the monitor after its current poll.
+func (m *monitor) remove() {
+	m.removed.Store(true)
+	m.state.Store(stateRemoved)
+	close(m.stop)
+}
+
+// label names the server in output shared with other servers, and is
+// empty when only one server is monitored.
+func (m *monitor) label() string {
+	if !m.c.multi {
+		return ""
+	}
+	return m.name
+}
+
+// prefix starts terminal lines about this server.
+func (m *monitor) prefix() string {
+	if !m.c.multi {
+		return ""
+	}
+	return "[" + m.name + "] "
+}
+
+// fileServer is the server written with each record, only needed when
+// several servers share one output.
+func (m *monitor) fileServer() string {
+	if !m.c.shared() {
+		return ""
+	}
+	return m.label()
+}
+
+// connect opens the pool and checks the connection, retrying as asked.
+func (m *monitor) connect() error {
+	opts := m.c.opts
+	m.db = m.open()
+	if err := connectWithRetry(m.c.ctx, m.db, m.name, m.cfg.Net, opts.ConnectRetries, opts.ConnectRetryInterval, opts.ConnectTimeout, opts.Wait); err != nil {
+		m.state.Store(stateDown)
+		return err
+	}
+	m.state.Store(stateConnected)
+
+	ctx, cancel := m.c.connectContext()
+	defer cancel()
+	reportCompression(ctx, m.db, compressionRequested(m.cfg), opts.Verbose)
+	// ProxySQL admin interfaces have no MySQL version or privileges to check
+	if !opts.ProxySQL {
+		m.detectServer(ctx)
+		m.checkProcessPrivilege(ctx)
+		// Hosts added later run the -where that was already checked
+		if opts.Where != "" && !m.added {
+			m.checkWhere(ctx)
+		}
+	}
+	return nil
+}
+
+// checkWhere runs the processlist query once, so a -where the server
+// rejects fails at startup instead of on every poll.
+func (m *monitor) checkWhere(ctx context.Context) {
+	_, err := m.processList(ctx)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		fatalf("%sinvalid -where %q: %s", m.prefix(), m.c.opts.Where, mysqlErr.Message)
+	}
+}
+
+// detectServer finds the server's flavor and version, which select the
+// processlist source and columns. Unknown servers get the columns every
+// version has.
+func (m *monitor) detectServer(ctx context.Context) {
+	info, err := catch.DetectServer(ctx, m.db)
+	m.serverChecked = time.Now()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning: could not detect the server version, reading the common processlist columns: %v\n",
+			m.prefix(), err)
+		return
+	}
+	m.server = info
+	fmt.Printf("%sServer: %s, reading %s\n", m.prefix(), info, info.ProcessListSource())
+	m.checkStore()
+}
+
+// checkStore refuses to go on when the monitored server is the -store-dsn
+// one, whose inserts would show up in the captures they are storing.
+func (m *monitor) checkStore() {
+	if m.c.store != nil && m.c.store.isServer(m.server) {
+		fatalf("%s-store-dsn points at the monitored server (%s), store the captures on another server",
+			m.prefix(), describeServer(m.server))
+	}
+}
+
+// checkProcessPrivilege warns on the terminal and in the capture file when
+// the account can't see other sessions, which is fatal with
+// -require-process-priv.
+func (m *monitor) checkProcessPrivilege(ctx context.Context) {
+	opts := m.c.opts
+	ok, err := hasProcessPrivilege(ctx, m.db)
+	if err != nil {
+		if opts.RequireProcessPriv {
+			fatalf("%scould not check the PROCESS privilege: %v", m.prefix(), err)
+		}
+		if opts.Verbose {
+			fmt.Printf("%sCould not check the PROCESS privilege: %v\n", m.prefix(), err)
+		}
+		return
+	}
+	if ok {
+		return
+	}
+
+	msg := fmt.Sprintf("user %s lacks the PROCESS privilege, output is limited to its own sessions", m.cfg.User)
+	if opts.RequireProcessPriv {
+		fatalf("%s%s", m.prefix(), msg)
+	}
+	color.New(color.FgRed, color.Bold).Fprintf(os.Stderr, "%sWarning: %s\n", m.prefix(), msg)
+	if err := m.writeFile([]byte(m.fileEvent("WARNING", msg))); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// reconnect rebuilds the pool until the server is back, and reports false
+// when the capture was stopped first.
+func (m *monitor) reconnect() bool {
+	m.state.Store(stateReconnecting)
+	db, ok := reconnect(m.c.ctx, m.db, m.open, m.name, m.c.opts.ConnectTimeout, m.sleep)
+	m.db = db
+	if ok && !m.removed.Load() {
+		m.state.Store(stateConnected)
+	}
+	// The server may have been replaced while it was away
+	m.serverStale = ok
+	return ok
+}
+
+// refreshServer reads the server identity again, writing a SERVER CHANGED
+// event to writer when a different server now answers at the address. The
+// identity is recorded again after a change or a reconnect.
+func (m *monitor) refreshServer(ctx context.Context, writer *bufio.Writer) {
+	info, err := catch.DetectServer(ctx, m.db)
+	m.serverChecked = time.Now()
+	if err != nil {
+		// The processlist query reports the connection problem
+		return
+	}
+	old := m.server
+	m.server = info
+	m.checkStore()
+	if old.Version == "" {
+		fmt.Printf("%sServer: %s, reading %s\n", m.prefix(), info, info.ProcessListSource())
+	}
+	if old.UUID != "" && info.UUID != old.UUID {
+		msg := fmt.Sprintf("was %s, now %s", describeServer(old), describeServer(info))
+		color.New(color.FgRed, color.Bold).Fprintf(os.Stderr, "%s %sSERVER CHANGED: %s\n",
+			time.Now().Format("2006-01-02 15:04:05"), m.prefix(), msg)
+		writer.WriteString(m.fileEvent("SERVER CHANGED", msg))
+		m.serverStale = true
+	}
+	if m.serverStale {
+		m.serverStale = false
+		m.serverFile = ""
+	}
+}
+
+// filename is the capture file for today, or for the current
+// -rotate-interval: one per server, or one shared by all of them with
+// -merge-output. With -max-size a full file is
+// followed by <name>.1.txt, <name>.2.txt and so on. -compress-output adds
+// .gz or .zst. Parquet files end in
+// .parquet, and since they can't be appended to, one left by an earlier
+// run is followed the same way.
+func (m *monitor) filename() string {
+	base := m.c.opts.File
+	if base == "" {
+		base = "load_test"
+	}
+	ext := ".txt" + compressionExt(m.c.opts.CompressOutput)
+	if m.c.parquet {
+		ext = ".parquet"
+		base = strings.TrimSuffix(base, ext)
+	}
+	if m.c.multi && !m.c.opts.MergeOutput {
+		base += "-" + m.fileHost()
+	}
+	base += "-" + fileStamp(time.Now(), m.c.opts.RotateInterval)
+
+	maxSize := int64(m.c.opts.MaxSize)
+	if maxSize <= 0 && !m.c.parquet {
+		return base + ext
+	}
+	if base != m.fileBase {
+		m.fileBase, m.fileSeq = base, 0
+	}
+	for {
+		name := base + ext
+		if m.fileSeq > 0 {
+			name = fmt.Sprintf("%s.%d%s", base, m.fileSeq, ext)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return name
+		}
+		open := *m.parquetSlot() != nil && (*m.parquetSlot()).name == name
+		if (!m.c.parquet || open) && (maxSize <= 0 || info.Size() < maxSize) {
+			return name
+		}
+		m.fileSeq++
+	}
+}
+
+// parquetSlot is where the open -o parquet file of this monitor is kept:
+// its own, or the one shared with -merge-output.
+func (m *monitor) parquetSlot() **parquetFile {
+	if m.c.opts.MergeOutput {
+		return &m.c.parquetFile
+	}
+	return &m.parquetFile
+}
+
+// writeParquet adds one poll's processes to the -o parquet file, closing
+// the previous file when the day or -max-size moves on to a new one.
+func (m *monitor) writeParquet(polledAt time.Time, processes []catch.Process) error {
+	if m.c.opts.MergeOutput {
+		m.c.fileMu.Lock()
+		defer m.c.fileMu.Unlock()
+	}
+	slot := m.parquetSlot()
+	name := m.filename()
+	if *slot != nil && (*slot).name != name {
+		err := (*slot).Close()
+		*slot = nil
+		if err != nil {
+			return err
+		}
+	}
+	if *slot == nil {
+		// A Parquet file holds no events, the deletions are only shown
+		m.prune(name)
+		file, err := createParquetFile(name)
+		if err != nil {
+			return err
+		}
+		*slot = file
+	}
+	m.moveTo(name)
+	return (*slot).write(m.name, polledAt, processes, m.c.opts.RowGroupPolls)
+}
+
+// fileHost names the server in its own capture files, by its alias if
+// it has one.
+func (m *monitor) fileHost() string {
+	host := m.entry.Host
+	if m.entry.Alias != "" {
+		host = m.entry.Alias
+	}
+	return fileLabel(host)
+}
+
+// fileLabel makes host usable in a file name.
+func fileLabel(host string) string {
+	return strings.NewReplacer("[", "", "]", "", ":", "_", "/", "_").Replace(host)
+}
+
+// writeFile appends one poll's output to the capture file, starting new
+// files with the format's header. Without a file, JSON and CSV records go
+// to stdout and text is dropped, since the terminal already shows it.
+func (m *monitor) writeFile(batch []byte) error {
+	if m.c.database != nil || m.c.parquet || m.c.syslog != nil {
+		return nil
+	}
+	if m.c.stdout {
+		if m.c.format != formatText {
+			m.c.writeRecords(m.serverEvent("-") + string(batch))
+		}
+		return nil
+	}
+	if m.c.opts.MergeOutput {
+		m.c.fileMu.Lock()
+		defer m.c.fileMu.Unlock()
+	}
+
+	name := m.filename()
+	// A quiet poll leaves a started file alone rather than reopen it
+	if len(batch) == 0 && name == m.lastFile && !m.serverPending(name) {
+		return nil
+	}
+	if m.c.opts.CompressOutput != "" {
+		return m.writeCompressed(name, batch)
+	}
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var start string
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		start = m.fileStart(name)
+	}
+	if name != m.lastFile {
+		start += m.prune(name)
+	}
+	// The poll goes to the file in one write, never split by a rotation
+	n, err := file.Write([]byte(start + m.serverEvent(name) + string(batch)))
+	m.wrote(name, n)
+	return err
+}
+
+// wrote records that n bytes went to the capture file name.
+func (m *monitor) wrote(name string, n int) {
+	m.moveTo(name)
+	m.file.Store(name)
+	m.fileBytes.Add(int64(n))
+}
+
+// moveTo makes name the capture file of this monitor, noting a rotation
+// from the previous one.
+func (m *monitor) moveTo(name string) {
+	if m.lastFile != "" && m.lastFile != name {
+		fmt.Printf("%sContinuing in %s\n", m.prefix(), name)
+	}
+	m.lastFile = name
+}
+
+// writeCompressed appends batch to the -compress-output file name, closing
+// the previous file when the day or -max-size moves on to a new one.
+func (m *monitor) writeCompressed(name string, batch []byte) error {
+	slot := &m.compressedFile
+	if m.c.opts.MergeOutput {
+		slot = &m.c.compressedFile
+	}
+	if *slot != nil && (*slot).name != name {
+		err := (*slot).Close()
+		*slot = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	var start string
+	if *slot == nil {
+		if info, err := os.Stat(name); err != nil || info.Size() == 0 {
+			start = m.fileStart(name)
+		}
+		start += m.prune(name)
+		file, err := openCompressedFile(name, m.c.opts.CompressOutput)
+		if err != nil {
+			return err
+		}
+		*slot = file
+	}
+	chunk := start + m.serverEvent(name) + string(batch)
+	if err := (*slot).write([]byte(chunk), m.c.opts.FlushInterval); err != nil {
+		return err
+	}
+	m.wrote(name, len(chunk))
+	return nil
+}
+
+// fileStart begins the new capture file name: the format's header, the
+// build that wrote the file and, when the capture moved on from another
+// file, a CONTINUED event naming it.
+func (m *monitor) fileStart(name string) string {
+	header, err := fileHeader(m.c.format, m.c.opts.CSVNoHeader)
+	if err != nil {
+		fmt.Printf("Error writing file header: %v\n", err)
+	}
+	start := header + formatFileEvent(m.c.format, "VERSION", versionString())
+	if m.lastFile != "" && m.lastFile != name {
+		start += m.fileEvent("CONTINUED", "continues "+m.lastFile)
+	}
+	return start
+}
+
+// serverPending reports whether the server's identity is yet to be
+// recorded in file. ProxySQL has none to record.
+func (m *monitor) serverPending(file string) bool {
+	return m.server.Version != "" && m.serverFile != file
+}
+
+// serverEvent records the server's identity, flavor and version the first
+// time this monitor writes to file, so later analysis knows which server
+// and columns to expect.
+func (m *monitor) serverEvent(file string) string {
+	if !m.serverPending(file) {
+		return ""
+	}
+	m.serverFile = file
+	record, err := formatServerFile(m.server, m.c.format, m.fileServer())
+	if err != nil {
+		fmt.Printf("%sError formatting the server identity: %v\n", m.prefix(), err)
+	}
+	return record
+}
+
+// fileEvent renders an event for the capture file, naming the server when
+// the file is shared.
+func (m *monitor) fileEvent(event, message string) string {
+	if server := m.fileServer(); server != "" {
+		message = server + ": " + message
+	}
+	return formatFileEvent(m.c.format, event, message)
+}
+
+// run polls until the capture is stopped, -once or -count is reached, or
+// reconnecting is interrupted.
+func (m *monitor) run() {
+	opts := m.c.opts
+	if m.state.Load() == stateDown {
+		if opts.Once {
+			m.failed = true
+			return
+		}
+		if !m.reconnect() {
+			return
+		}
+	}
+
+	for {
+		m.polls++
+
+		var batch bytes.Buffer
+		writer := bufio.NewWriter(&batch)
+		ok := m.poll(writer)
+		writer.Flush()
+		if err := m.writeFile(batch.Bytes()); err != nil {
+			fatalf("%v", err)
+		}
+
+		if !ok || opts.Once || (opts.Count > 0 && m.polls >= opts.Count) || !m.sleepUntilPoll() {
+			m.flushStatements()
+			return
+		}
+	}
+}
+
+// sleepUntilPoll waits for the next poll like sleep. When the capture file
+// rotates in the meantime, the files kept open are closed right at the
+// boundary, so the finished file stops changing then rather than at the
+// next poll.
+func (m *monitor) sleepUntilPoll() bool {
+	d := m.c.interval
+	if until := time.Until(nextRotation(time.Now(), m.c.opts.RotateInterval)); until < d {
+		if !m.sleep(until) {
+			return false
+		}
+		if err := m.closeFiles(); err != nil {
+			fatalf("%v", err)
+		}
+		d -= until
+	}
+	return m.sleep(d)
+}
+
+// closeFiles closes the -o parquet and -compress-output file this monitor
+// writes, to be reopened by the next write.
+func (m *monitor) closeFiles() error {
+	parquetSlot, compressedSlot := &m.parquetFile, &m.compressedFile
+	if m.c.opts.MergeOutput {
+		m.c.fileMu.Lock()
+		defer m.c.fileMu.Unlock()
+		parquetSlot, compressedSlot = &m.c.parquetFile, &m.c.compressedFile
+	}
+	if *parquetSlot != nil {
+		err := (*parquetSlot).Close()
+		*parquetSlot = nil
+		if err != nil {
+			return err
+		}
+	}
+	if *compressedSlot != nil {
+		err := (*compressedSlot).Close()
+		*compressedSlot = nil
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushStatements writes the statements -o slowlog saw until the end, with
+// the time they had run for by then.
+func (m *monitor) flushStatements() {
+	if m.slowLog == nil {
+		return
+	}
+	if err := m.writeFile([]byte(m.slowLog.finished(true))); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+// processList reads the processlist of the server, or the sessions of a
+// ProxySQL admin interface.
+func (m *monitor) processList(ctx context.Context) ([]catch.Process, error) {
+	if m.c.opts.ProxySQL {
+		return catch.ProxySQLProcessList(ctx, m.db)
+	}
+	return catch.ProcessListWith(ctx, m.db, m.server, m.c.query)
+}
+
+// lockWaits captures the InnoDB lock waits for -blocking, writing them to
+// writer and the terminal output out.
+func (m *monitor) lockWaits(ctx context.Context, writer *bufio.Writer, out *strings.Builder) {
+	waits, err := catch.LockWaits(ctx, m.db, m.server)
+	if err != nil {
+		if !m.lockWaitsFailed {
+			m.lockWaitsFailed = true
+			fmt.Fprintf(os.Stderr, "%sWarning: cannot read lock waits, -blocking reports nothing: %v\n", m.prefix(), err)
+		}
+		return
+	}
+	for _, w := range waits {
+		fileOutput, err := formatLockWaitFile(w, m.c.format, m.fileServer())
+		if err != nil {
+			fmt.Printf("%sError formatting lock wait of process %d: %v\n", m.prefix(), w.WaitingID, err)
+			continue
+		}
+		writer.WriteString(fileOutput)
+		out.WriteString(catch.FormatLockWait(w, m.label(), true))
+	}
+}
+
+// explain captures the plan of each SELECT running longer than
+// -explain-time, once per statement. A statement that can't be explained
+// is noted on stderr and the capture goes on.
+func (m *monitor) explain(ctx context.Context, processes []catch.Process, writer *bufio.Writer, out *strings.Builder) {
+	explained := map[statementKey]bool{}
+	for _, p := range processes {
+		if p.Command != "Query" || p.Time <= m.c.opts.ExplainTime || catch.ClassifyQuery(p.Info.String) != catch.QuerySelect {
+			continue
+		}
+		key := statementKey{p.ID, p.Info.String}
+		explained[key] = true
+		if m.explained[key] {
+			continue
+		}
+		plan, err := catch.Explain(ctx, m.db, p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%sWarning: cannot EXPLAIN the statement of process %d: %v\n", m.prefix(), p.ID, err)
+			continue
+		}
+		fileOutput, err := formatPlanFile(p.ID, p.Info.String, plan, m.c.format, m.fileServer())
+		if err != nil {
+			fmt.Printf("%sError formatting the plan of process %d: %v\n", m.prefix(), p.ID, err)
+			continue
+		}
+		writer.WriteString(fileOutput)
+		out.WriteString(catch.FormatPlan(p.ID, p.Info.String, plan, m.label()))
+	}
+	m.explained = explained
+}
+
+// replication captures the replication status for -repl. Its failures only
+// warn, they never stop the processlist capture.
+func (m *monitor) replication(ctx context.Context, writer *bufio.Writer, out *strings.Builder) {
+	statuses, err := catch.ReplicationStatus(ctx, m.db)
+	if err != nil || len(statuses) == 0 {
+		if !m.replicationNoted {
+			m.replicationNoted = true
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%sWarning: cannot read the replication status, -repl reports nothing: %v\n", m.prefix(), err)
+			} else {
+				fmt.Fprintf(os.Stderr, "%sWarning: server is not a replica, -repl reports nothing\n", m.prefix())
+			}
+		}
+		return
+	}
+
+	threshold := int64(m.c.opts.ReplLagThreshold)
+	for _, s := range statuses {
+		fileOutput, err := formatReplicaFile(s, m.c.format, m.fileServer())
+		if err != nil {
+			fmt.Printf("%sError formatting replication status: %v\n", m.prefix(), err)
+			continue
+		}
+		writer.WriteString(fileOutput)
+
+		behind := !s.SecondsBehind.Valid || s.SecondsBehind.Int64 > threshold
+		lineColor := color.New(color.FgGreen)
+		if behind || !s.Running() || s.LastError != "" {
+			lineColor = color.New(color.FgRed, color.Bold)
+		}
+		out.WriteString(m.prefix() + lineColor.Sprintf("Replication %s", describeReplica(s)) + "\n")
+	}
+}
+
+// writeAgain reports whether p goes to the capture file of the poll at now.
+// With -dedup a statement the previous poll wrote is skipped, unless
+// -dedup-interval has passed since it was last written. The statements
+// written are recorded in written, for the next poll.
+func (m *monitor) writeAgain(p catch.Process, now time.Time, written map[statementKey]time.Time) bool {
+	if !m.c.opts.Dedup {
+		return true
+	}
+	key := statementKey{p.ID, p.Info.String}
+	last, ok := m.written[key]
+	interval := m.c.opts.DedupInterval
+	if ok && (interval <= 0 || now.Sub(last) < interval) {
+		written[key] = last
+		return false
+	}
+	written[key] = now
+	return true
+}
+
+// raiseAlerts sends an alert for each process running longer than
+// -alert-time, once per process ID until it is gone from the processlist,
+// and notes it on stderr, where a repainted table does not wipe it out.
+func (m *monitor) raiseAlerts(processes []catch.Process, at time.Time) {
+	alerted := map[int64]bool{}
+	for _, p := range processes {
+		if m.alerted[p.ID] {
+			alerted[p.ID] = true
+			continue
+		}
+		if p.Time < m.c.alerts.threshold {
+			continue
+		}
+		alerted[p.ID] = true
+		m.c.alerts.send(alert{process: p, host: m.name, at: at}, m.prefix())
+		color.New(color.FgRed, color.Bold).Fprintf(os.Stderr, "%sAlert: process %d of %s has been running for %ds\n",
+			m.prefix(), p.ID, p.User, p.Time)
+	}
+	m.alerted = alerted
+}
+
+// poll captures the processlist once, writing the file output to writer.
+// It reports false when polling should stop.
+func (m *monitor) poll(writer *bufio.Writer) bool {
+	opts := m.c.opts
+
+	// Bounded by the read timeout, so a hung query can't hold up shutdown
+	ctx, cancel := m.c.queryContext()
+	defer cancel()
+
+	if !opts.ProxySQL && (m.serverStale || time.Since(m.serverChecked) >= serverCheckInterval) {
+		m.refreshServer(ctx, writer)
+	}
+
+	queryStart := time.Now()
+	processes, err := m.processList(ctx)
+	queryTime := time.Since(queryStart)
+	if err != nil {
+		if m.c.ctx.Err() != nil {
+			// Interrupted by shutdown, not a failure
+			return false
+		}
+		if isTimeout(err, queryTime, opts.ReadTimeout) {
+			// Explain the gap in the capture
+			msg := fmt.Sprintf("processlist query timed out after %s, no data for this poll", opts.ReadTimeout)
+			fmt.Fprintf(os.Stderr, "%s %sWarning: %s\n", time.Now().Format("2006-01-02 15:04:05"), m.prefix(), msg)
+			writer.WriteString(m.fileEvent("TIMEOUT", msg))
+		} else {
+			fmt.Printf("%sError: %v\n", m.prefix(), err)
+		}
+
+		if opts.Once {
+			m.failed = true
+			return false
+		}
+		// SQL errors such as missing privileges won't be fixed by
+		// reconnecting, only rebuild the pool for connection errors
+		if isConnectionError(err) {
+			if !m.reconnect() {
+				return false
+			}
+			writer.WriteString(m.fileEvent("RECONNECTED",
+				fmt.Sprintf("connection to %s re-established", m.name)))
+		}
+		return true
+	}
+
+	if m.c.stats != nil {
+		m.c.stats.update(m.name, processes)
+	}
+
+	var shown []catch.Process
+	for _, p := range processes {
+		if m.c.selects(p) {
+			shown = append(shown, p)
+		}
+	}
+
+	// Only what the filters let through is killed, -top only limits the output
+	if opts.Kill {
+		killLongQueries(ctx, m.db, shown, opts.KillTime, opts.Yes, writer, m.c.format, m.label())
+	}
+
+	// The list is sorted by TIME, so these are the longest running
+	if opts.Top > 0 && len(shown) > opts.Top {
+		shown = shown[:opts.Top]
+	}
+	m.c.order.sort(shown)
+
+	// Terminal output for this poll, printed in one piece
+	var out strings.Builder
+
+	written := map[statementKey]time.Time{}
+	for _, p := range shown {
+		info := p.Info.String
+		queryType := catch.ClassifyQuery(info)
+
+		if opts.Verbose {
+			fmt.Fprintf(&out, "%sDebug: Found %s query - State: %s, Time: %d, Info: %.100s...\n",
+				m.prefix(), queryType, p.State.String, p.Time, info)
+		}
+
+		if opts.Debug && queryType == catch.QuerySelect {
+			n := m.queryCount.Add(1)
+			fmt.Fprintf(&out, "%sDebug: Query #%d detected: %.100s...\nState: %s, Time: %d\n\n",
+				m.prefix(), n, p.Info.String, p.State.String, p.Time)
+		}
+
+		// Write to file without colors; a snapshot, the general log, the
+		// database and a Parquet file hold the whole poll, the slow log a
+		// statement once it has finished, and -syslog replaces the file
+		if m.slowLog != nil {
+			m.slowLog.observe(p, queryStart)
+		} else if m.c.syslog != nil {
+			if m.writeAgain(p, queryStart, written) {
+				m.c.syslog.send(m.label(), m.name, p)
+			}
+		} else if !m.c.snapshot && m.generalLog == nil && m.c.database == nil && !m.c.parquet && m.writeAgain(p, queryStart, written) {
+			fileOutput, err := formatFileOutput(p, m.c.format, m.fileServer(), m.name)
+			if err != nil {
+				fmt.Printf("%sError formatting process %d: %v\n", m.prefix(), p.ID, err)
+				continue
+			}
+			writer.WriteString(fileOutput)
+		}
+
+		m.captured++
+		m.statsCaptured.Add(1)
+
+		if opts.Summary || opts.ByUser || opts.Diff || opts.Output == formatTable {
+			continue
+		}
+
+		// Print to terminal with colors
+		out.WriteString(catch.FormatProcess(p, m.label(), true))
+	}
+
+	if opts.Dedup {
+		m.written = written
+	}
+	if m.slowLog != nil {
+		writer.WriteString(m.slowLog.finished(false))
+	}
+	if m.generalLog != nil {
+		writer.WriteString(m.generalLog.poll(processes, shown, queryStart))
+	}
+	if m.c.parquet {
+		if err := m.writeParquet(queryStart, shown); err != nil {
+			fatalf("%v", err)
+		}
+	}
+	if m.c.store != nil {
+		m.c.store.enqueue(m.name, queryStart, shown)
+	}
+	if m.c.alerts != nil {
+		m.raiseAlerts(shown, queryStart)
+	}
+	if m.c.database != nil {
+		if err := m.c.database.insertPoll(m.name, queryStart, shown); err != nil {
+			fmt.Fprintf(os.Stderr, "%sError storing poll %d: %v\n", m.prefix(), m.polls, err)
+		}
+	}
+	if m.c.snapshot {
+		snapshot, err := formatSnapshot(shown, m.name, m.polls, queryTime, queryStart)
+		if err != nil {
+			fmt.Printf("%sError formatting poll %d: %v\n", m.prefix(), m.polls, err)
+		}
+		writer.WriteString(snapshot)
+	}
+
+	switch {
+	case opts.Summary:
+		if opts.SummaryRefresh {
+			// Clear the screen and repaint from the top
+			out.WriteString("\033[H\033[2J")
+		}
+		out.WriteString(summarize(m.label(), shown).String())
+	case opts.ByUser:
+		out.WriteString(formatUserTable(shown, m.label()))
+	case opts.Diff:
+		out.WriteString(m.diff(shown))
+	case opts.Output == formatTable:
+		// Repaint a single server's table in place; tables of several
+		// servers would overwrite each other
+		if !m.c.multi {
+			out.WriteString("\033[H\033[2J")
+		}
+		out.WriteString(formatProcessTable(shown, m.label(), terminalWidth()))
+	}
+
+	if opts.ExplainTime > 0 {
+		m.explain(ctx, shown, writer, &out)
+	}
+	if opts.Blocking {
+		m.lockWaits(ctx, writer, &out)
+	}
+	if opts.Repl {
+		m.replication(ctx, writer, &out)
+	}
+
+	// Keep records written to stdout parseable
+	if !opts.Quiet && (!m.c.stdout || m.c.format == formatText) {
+		m.c.print(out.String())
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// TestQuietPollLeavesFileAlone checks that a poll with nothing to write
+// doesn't reopen a started capture file, so a file moved away stays gone,
+// with and without a server identity to record.
+func TestQuietPollLeavesFileAlone(t *testing.T) {
+	for name, server := range map[string]catch.ServerInfo{
+		"MySQL":    {Flavor: "mysql", Version: "8.0.36", Major: 8},
+		"ProxySQL": {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := &options{File: filepath.Join(t.TempDir(), "capture")}
+			m := &monitor{c: &capture{opts: opts, format: formatText}, name: "db1", server: server}
+
+			if err := m.writeFile([]byte("first poll\n")); err != nil {
+				t.Fatal(err)
+			}
+			file := m.lastFile
+			if err := os.Remove(file); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.writeFile(nil); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Errorf("quiet poll reopened %s: %v", file, err)
+			}
+
+			// A server identity not yet recorded is still written
+			if server.Version != "" {
+				m.serverFile = ""
+				if err := m.writeFile(nil); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Stat(file); err != nil {
+					t.Errorf("server identity not recorded: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// .mylogin.cnf layout, as written by mysql_config_editor: 4 unused bytes,
+// a 20 byte key, then one length-prefixed AES-128-ECB chunk per line.
+const (
+	loginFileUnusedLen = 4
+	loginFileKeyLen    = 20
+)
+
+func loginFilePath() string {
+	if path := os.Getenv("MYSQL_TEST_LOGIN_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mylogin.cnf")
+}
+
+// decryptLoginFile returns the plain text option file stored in data.
+func decryptLoginFile(data []byte) (string, error) {
+	header := loginFileUnusedLen + loginFileKeyLen
+	if len(data) < header {
+		return "", errors.New("file is too short")
+	}
+
+	// The AES key is the stored key XOR-folded into 16 bytes
+	key := make([]byte, aes.BlockSize)
+	for i, b := range data[loginFileUnusedLen:header] {
+		key[i%aes.BlockSize] ^= b
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	var plain strings.Builder
+	rest := data[header:]
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return "", errors.New("truncated chunk length")
+		}
+		n := int(binary.LittleEndian.Uint32(rest))
+		rest = rest[4:]
+		if n == 0 || n > len(rest) || n%aes.BlockSize != 0 {
+			return "", fmt.Errorf("invalid chunk length %d", n)
+		}
+
+		chunk := make([]byte, n)
+		for i := 0; i < n; i += aes.BlockSize {
+			block.Decrypt(chunk[i:i+aes.BlockSize], rest[i:i+aes.BlockSize])
+		}
+		// Strip PKCS#7 padding
+		if pad := int(chunk[n-1]); pad > 0 && pad <= aes.BlockSize {
+			chunk = chunk[:n-pad]
+		}
+		plain.Write(chunk)
+		rest = rest[n:]
+	}
+	return plain.String(), nil
+}
+
+// readLoginFile merges the login paths stored in the .mylogin.cnf at path
+// into options. A missing file is only an error when loginPath is requested,
+// and a loginPath that isn't in the file is reported with the ones that are.
+func readLoginFile(path string, options optionFile, loginPath string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && loginPath == "" {
+			return nil
+		}
+		return fmt.Errorf("reading login path file: %w", err)
+	}
+
+	content, err := decryptLoginFile(data)
+	if err != nil {
+		return fmt.Errorf("decrypting %s: %w", path, err)
+	}
+
+	paths := optionFile{}
+	if err := parseOptions(content, path, paths, 0); err != nil {
+		return err
+	}
+
+	if loginPath != "" {
+		if _, ok := paths[loginPath]; !ok {
+			var available []string
+			for name := range paths {
+				if name != globalGroup {
+					available = append(available, name)
+				}
+			}
+			sort.Strings(available)
+			return fmt.Errorf("login path %q not found in %s (available: %s)",
+				loginPath, path, strings.Join(available, ", "))
+		}
+	}
+
+	for group, values := range paths {
+		if options[group] == nil {
+			options[group] = map[string]string{}
+		}
+		for key, value := range values {
+			options[group][key] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// Output formats for the capture file
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatTSV  = "tsv"
+	// formatSlowLog writes finished statements as a MySQL slow query log
+	formatSlowLog = "slowlog"
+	// formatGeneralLog writes new statements as a MySQL general query log
+	formatGeneralLog = "general-log"
+	// formatJSONL is another name for json, which is already JSON Lines
+	formatJSONL = "jsonl"
+	// formatJSONSnapshot writes JSON with one document per poll instead of
+	// one per process
+	formatJSONSnapshot = "json-snapshot"
+	// formatTable is a terminal view; its capture file is written as text
+	formatTable = "table"
+	// formatParquet writes the processes to Parquet files, see parquet.go
+	formatParquet = "parquet"
+)
+
+var outputFormats = []string{formatText, formatJSON, formatJSONL, formatJSONSnapshot, formatCSV, formatTSV, formatSlowLog, formatGeneralLog, formatParquet, formatTable}
+
+// jsonTimeFormat is RFC3339 with milliseconds, for the captured_at fields
+const jsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// fileFormat is the capture file format for the -o format.
+func fileFormat(format string) string {
+	switch format {
+	case formatTable:
+		return formatText
+	case formatJSONL, formatJSONSnapshot:
+		return formatJSON
+	}
+	if format == formatParquet || strings.HasPrefix(format, sqlitePrefix) {
+		// Only the terminal output, the processes go to the Parquet file
+		// or the database
+		return formatText
+	}
+	return format
+}
+
+// isDelimited reports whether format writes only rows of columns, which
+// keep the file loadable as it is: build and server metadata is left out.
+func isDelimited(format string) bool {
+	return format == formatCSV || format == formatTSV
+}
+
+// csvHeader names the CSV columns. host is the monitored server, the
+// processlist HOST is client_host.
+var csvHeader = []string{"captured_at", "host", "id", "user", "client_host", "db", "command", "time", "state", "info"}
+
+func validateOutputFormat(format string) error {
+	if path, ok := strings.CutPrefix(format, sqlitePrefix); ok {
+		if path == "" {
+			return fmt.Errorf("-o %s needs the path of the database, e.g. %scaptures.db", sqlitePrefix, sqlitePrefix)
+		}
+		return nil
+	}
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q (valid: %s, or %s<path>)", format, strings.Join(outputFormats, ", "), sqlitePrefix)
+}
+
+// processRecord holds what a capture file's JSON record adds to the
+// encoding of catch.Process.
+type processRecord struct {
+	CapturedAt string `json:"captured_at"`
+	Server     string `json:"server,omitempty"`
+	// MonitoredHost is the alias or address of the server, in every record
+	MonitoredHost string `json:"monitored_host"`
+}
+
+func nullableString(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+// formatProcessJSON renders p, captured on host, as a single NDJSON line.
+func formatProcessJSON(p catch.Process, server, host string, capturedAt time.Time) (string, error) {
+	record, err := json.Marshal(processRecord{
+		CapturedAt:    capturedAt.Format(jsonTimeFormat),
+		Server:        server,
+		MonitoredHost: host,
+	})
+	if err != nil {
+		return "", err
+	}
+	process, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	// One object: the record's fields, then the process's
+	return string(record[:len(record)-1]) + "," + string(process[1:]) + "\n", nil
+}
+
+// snapshotRecord is the JSON document of one poll for -o json-snapshot.
+// Processes is empty, not null, when nothing was captured, so an idle
+// server can be told apart from a missing poll.
+type snapshotRecord struct {
+	CapturedAt string `json:"captured_at"`
+	Event      string `json:"event"`
+	// Sequence counts the polls of the host from 1
+	Sequence      int             `json:"sequence"`
+	MonitoredHost string          `json:"monitored_host"`
+	DurationMS    float64         `json:"duration_ms"`
+	Processes     []catch.Process `json:"processes"`
+}
+
+// formatSnapshot renders the processes captured by poll sequence on host as
+// a single JSON line. duration is how long the processlist query took.
+func formatSnapshot(processes []catch.Process, host string, sequence int, duration time.Duration, capturedAt time.Time) (string, error) {
+	if processes == nil {
+		processes = []catch.Process{}
+	}
+	data, err := json.Marshal(snapshotRecord{
+		CapturedAt:    capturedAt.Format(jsonTimeFormat),
+		Event:         "POLL",
+		Sequence:      sequence,
+		MonitoredHost: host,
+		DurationMS:    float64(duration.Microseconds()) / 1000,
+		Processes:     processes,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+func formatCSVRecord(record []string) (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(record); err != nil {
+		return "", err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// formatProcessCSV renders p, captured on host, as a single CSV row in
+// csvHeader order. NULL columns are written as empty strings.
+func formatProcessCSV(p catch.Process, host string, capturedAt time.Time) (string, error) {
+	return formatCSVRecord([]string{
+		capturedAt.Format(jsonTimeFormat),
+		host,
+		strconv.FormatInt(p.ID, 10),
+		p.User,
+		p.Host,
+		p.DB.String,
+		p.Command,
+		strconv.Itoa(p.Time),
+		p.State.String,
+		p.Info.String,
+	})
+}
+
+// tsvEscaper keeps every TSV field on one line and free of column breaks
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// formatProcessTSV renders p, captured on host, as a single tab-separated
+// line: captured_at, id, user, client host, db, command, time, state, info
+// and host, so that TIME is field 7 for awk. Backslashes, tabs and newlines
+// are escaped as \\, \t and \n, NULL columns are empty.
+func formatProcessTSV(p catch.Process, host string, capturedAt time.Time) string {
+	fields := []string{
+		capturedAt.Format(jsonTimeFormat),
+		strconv.FormatInt(p.ID, 10),
+		p.User,
+		p.Host,
+		p.DB.String,
+		p.Command,
+		strconv.Itoa(p.Time),
+		p.State.String,
+		p.Info.String,
+		host,
+	}
+	for i, field := range fields {
+		fields[i] = tsvEscaper.Replace(field)
+	}
+	return strings.Join(fields, "\t") + "\n"
+}
+
+// fileHeader returns the text written at the top of a new capture file,
+// which is nothing but for CSV without -csv-no-header.
+func fileHeader(format string, noHeader bool) (string, error) {
+	if format == formatCSV && !noHeader {
+		return formatCSVRecord(csvHeader)
+	}
+	return "", nil
+}
+
+// formatFileOutput renders p, captured on host, for the capture file in the
+// given format, labeled with server when the file is shared by several
+// hosts.
+func formatFileOutput(p catch.Process, format, server, host string) (string, error) {
+	switch format {
+	case formatJSON:
+		return formatProcessJSON(p, server, host, time.Now())
+	case formatCSV:
+		return formatProcessCSV(p, host, time.Now())
+	case formatTSV:
+		return formatProcessTSV(p, host, time.Now()), nil
+	default:
+		return catch.FormatProcess(p, server, false), nil
+	}
+}
+
+// lockWaitRecord is the JSON representation of a lock wait, told apart
+// from process records by its event field.
+type lockWaitRecord struct {
+	CapturedAt    string  `json:"captured_at"`
+	Event         string  `json:"event"`
+	WaitingID     int64   `json:"waiting_id"`
+	WaitingQuery  *string `json:"waiting_query"`
+	WaitTime      int     `json:"wait_time"`
+	BlockingID    int64   `json:"blocking_id"`
+	BlockingQuery *string `json:"blocking_query"`
+	BlockingTime  int     `json:"blocking_time"`
+	Table         string  `json:"table"`
+	Index         *string `json:"index"`
+	LockMode      string  `json:"lock_mode"`
+	Server        string  `json:"server,omitempty"`
+}
+
+// formatLockWaitFile renders w for the capture file in the given format.
+// CSV and TSV files hold processes only, so there it is left out, and in
+// the log formats it is a comment line.
+func formatLockWaitFile(w catch.LockWait, format, server string) (string, error) {
+	switch format {
+	case formatCSV, formatTSV:
+		return "", nil
+	case formatJSON:
+		data, err := json.Marshal(lockWaitRecord{
+			CapturedAt:    time.Now().Format(jsonTimeFormat),
+			Event:         "LOCK_WAIT",
+			WaitingID:     w.WaitingID,
+			WaitingQuery:  nullableString(w.WaitingQuery),
+			WaitTime:      w.WaitTime,
+			BlockingID:    w.BlockingID,
+			BlockingQuery: nullableString(w.BlockingQuery),
+			BlockingTime:  w.BlockingTime,
+			Table:         w.Table,
+			Index:         nullableString(w.Index),
+			LockMode:      w.LockMode,
+			Server:        server,
+		})
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case formatSlowLog, formatGeneralLog:
+		// One line, whatever newlines the statements have
+		waiting := strings.Join(strings.Fields(w.WaitingQuery.String), " ")
+		blocking := strings.Join(strings.Fields(w.BlockingQuery.String), " ")
+		if !w.BlockingQuery.Valid {
+			blocking = "NULL"
+		}
+		message := fmt.Sprintf("process %d waiting %ds on %s (%s): %s; blocked by process %d: %s",
+			w.WaitingID, w.WaitTime, w.Table, w.LockMode, waiting, w.BlockingID, blocking)
+		if server != "" {
+			message = server + " " + message
+		}
+		return formatFileEvent(format, "LOCK_WAIT", message), nil
+	default:
+		return catch.FormatLockWait(w, server, false), nil
+	}
+}
+
+// planRecord is the JSON representation of an EXPLAIN plan, one object
+// per row with the columns the server returned.
+type planRecord struct {
+	CapturedAt string               `json:"captured_at"`
+	Event      string               `json:"event"`
+	ID         int64                `json:"id"`
+	Query      string               `json:"query"`
+	Plan       []map[string]*string `json:"plan"`
+	Server     string               `json:"server,omitempty"`
+}
+
+// formatPlanFile renders the plan of the statement process id is running
+// for the capture file in the given format. CSV and TSV files hold
+// processes only, so there it is left out, and in the log formats each row
+// of the plan is a comment line.
+func formatPlanFile(id int64, statement string, plan catch.Plan, format, server string) (string, error) {
+	switch format {
+	case formatCSV, formatTSV:
+		return "", nil
+	case formatJSON:
+		record := planRecord{
+			CapturedAt: time.Now().Format(jsonTimeFormat),
+			Event:      "EXPLAIN",
+			ID:         id,
+			Query:      statement,
+			Plan:       []map[string]*string{},
+			Server:     server,
+		}
+		for _, row := range plan.Rows {
+			values := make(map[string]*string, len(row))
+			for i, value := range row {
+				values[plan.Columns[i]] = nullableString(value)
+			}
+			record.Plan = append(record.Plan, values)
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case formatSlowLog, formatGeneralLog:
+		prefix := fmt.Sprintf("process %d", id)
+		if server != "" {
+			prefix = server + " " + prefix
+		}
+		var b strings.Builder
+		for _, row := range plan.Rows {
+			fields := make([]string, len(row))
+			for i, value := range row {
+				fields[i] = plan.Columns[i] + "=NULL"
+				if value.Valid {
+					fields[i] = plan.Columns[i] + "=" + value.String
+				}
+			}
+			b.WriteString(formatFileEvent(format, "EXPLAIN", prefix+": "+strings.Join(fields, " ")))
+		}
+		return b.String(), nil
+	default:
+		return catch.FormatPlan(id, statement, plan, server), nil
+	}
+}
+
+// describeReplica summarizes a replication channel on one line.
+func describeReplica(s catch.ReplicaStatus) string {
+	var b strings.Builder
+	if s.Channel != "" {
+		fmt.Fprintf(&b, "channel %s ", s.Channel)
+	}
+	fmt.Fprintf(&b, "from %s: ", s.Source)
+	if s.SecondsBehind.Valid {
+		fmt.Fprintf(&b, "lag %ds", s.SecondsBehind.Int64)
+	} else {
+		b.WriteString("lag unknown")
+	}
+	fmt.Fprintf(&b, ", IO thread %s, SQL thread %s", s.IORunning, s.SQLRunning)
+	if s.LastError != "" {
+		fmt.Fprintf(&b, ", last error: %s", s.LastError)
+	}
+	return b.String()
+}
+
+// replicaRecord is the JSON representation of a replication status, told
+// apart from process records by its event field.
+type replicaRecord struct {
+	CapturedAt    string `json:"captured_at"`
+	Event         string `json:"event"`
+	Channel       string `json:"channel,omitempty"`
+	Source        string `json:"source"`
+	SecondsBehind *int64 `json:"seconds_behind_source"`
+	IORunning     string `json:"io_running"`
+	SQLRunning    string `json:"sql_running"`
+	LastError     string `json:"last_error,omitempty"`
+	Server        string `json:"server,omitempty"`
+}
+
+// formatReplicaFile renders s for the capture file in the given format, as
+// an event line outside JSON. CSV and TSV files hold processes only, so
+// there it is left out.
+func formatReplicaFile(s catch.ReplicaStatus, format, server string) (string, error) {
+	if isDelimited(format) {
+		return "", nil
+	}
+	if format != formatJSON {
+		message := describeReplica(s)
+		if server != "" {
+			message = server + " " + message
+		}
+		return formatFileEvent(format, "REPLICATION", message), nil
+	}
+
+	record := replicaRecord{
+		CapturedAt: time.Now().Format(jsonTimeFormat),
+		Event:      "REPLICATION",
+		Channel:    s.Channel,
+		Source:     s.Source,
+		IORunning:  s.IORunning,
+		SQLRunning: s.SQLRunning,
+		LastError:  s.LastError,
+		Server:     server,
+	}
+	if s.SecondsBehind.Valid {
+		record.SecondsBehind = &s.SecondsBehind.Int64
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+	return string(data) + "\n", nil
+}
+
+// describeServer names the server and where it runs on one line.
+func describeServer(info catch.ServerInfo) string {
+	description := info.String()
+	if info.Hostname != "" {
+		description += " on " + net.JoinHostPort(info.Hostname, strconv.Itoa(info.Port))
+	}
+	if info.UUID != "" {
+		description += ", server_uuid " + info.UUID
+	}
+	return description
+}
+
+// serverRecord is the JSON representation of the server identity written
+// at the top of capture files.
+type serverRecord struct {
+	CapturedAt     string `json:"captured_at"`
+	Event          string `json:"event"`
+	Hostname       string `json:"hostname"`
+	Port           int    `json:"port"`
+	Version        string `json:"version"`
+	VersionComment string `json:"version_comment"`
+	ServerUUID     string `json:"server_uuid,omitempty"`
+	Flavor         string `json:"flavor"`
+	Server         string `json:"server,omitempty"`
+}
+
+// formatServerFile renders the server identity for the capture file: a
+// block in text files, an object in JSON and a comment line in the log
+// formats. CSV and TSV files only have the host column.
+func formatServerFile(info catch.ServerInfo, format, server string) (string, error) {
+	now := time.Now()
+	switch format {
+	case formatCSV, formatTSV:
+		return "", nil
+	case formatJSON:
+		data, err := json.Marshal(serverRecord{
+			CapturedAt:     now.Format(jsonTimeFormat),
+			Event:          "SERVER",
+			Hostname:       info.Hostname,
+			Port:           info.Port,
+			Version:        info.Version,
+			VersionComment: info.Comment,
+			ServerUUID:     info.UUID,
+			Flavor:         info.Flavor,
+			Server:         server,
+		})
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case formatSlowLog, formatGeneralLog:
+		message := describeServer(info)
+		if server != "" {
+			message = server + ": " + message
+		}
+		return formatFileEvent(format, "SERVER", message), nil
+	default:
+		var b strings.Builder
+		fmt.Fprintf(&b, "*************************** Server @ %s ***************************\n", now.Format("2006-01-02 15:04:05"))
+		if server != "" {
+			fmt.Fprintf(&b, "   SERVER: %s\n", server)
+		}
+		fmt.Fprintf(&b, " HOSTNAME: %s\n"+
+			"     PORT: %d\n"+
+			"  VERSION: %s\n"+
+			"  COMMENT: %s\n"+
+			"   FLAVOR: %s\n"+
+			"     UUID: %s\n\n",
+			info.Hostname, info.Port, info.Version, info.Comment, info.Flavor, info.UUID)
+		return b.String(), nil
+	}
+}
+
+// formatFileEvent renders an out-of-band event, such as a killed query, for
+// the capture file in the given format. CSV and TSV files hold processes
+// only, so there events are left out; the terminal still shows them.
+func formatFileEvent(format, event, message string) string {
+	if isDelimited(format) {
+		return ""
+	}
+	now := time.Now()
+	switch format {
+	case formatJSON:
+		data, _ := json.Marshal(map[string]string{
+			"captured_at": now.Format(jsonTimeFormat),
+			"event":       event,
+			"message":     message,
+		})
+		return string(data) + "\n"
+	case formatSlowLog, formatGeneralLog:
+		// Comment lines keep the columns intact
+		return fmt.Sprintf("# %s %s: %s\n", now.Format("2006-01-02 15:04:05"), event, message)
+	default:
+		return fmt.Sprintf("--- %s %s: %s ---\n\n", now.Format("2006-01-02 15:04:05"), event, message)
+	}
+}
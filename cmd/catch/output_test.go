@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+func TestFileStartVersion(t *testing.T) {
+	tests := []struct {
+		format   string
+		noHeader bool
+		want     string // the whole start, or VERSION to look for that event
+	}{
+		{format: formatCSV, want: strings.Join(csvHeader, ",") + "\n"},
+		{format: formatCSV, noHeader: true},
+		{format: formatTSV},
+		{format: formatText, want: "VERSION"},
+		{format: formatJSON, want: "VERSION"},
+		{format: formatSlowLog, want: "VERSION"},
+	}
+	for _, tt := range tests {
+		m := &monitor{c: &capture{opts: &options{CSVNoHeader: tt.noHeader}, format: tt.format}}
+		got := m.fileStart("capture.txt")
+		switch {
+		case tt.want == "VERSION":
+			if !strings.Contains(got, "VERSION") {
+				t.Errorf("%s: got %q, want a VERSION event", tt.format, got)
+			}
+		case got != tt.want:
+			t.Errorf("%s (no header %v): got %q, want %q", tt.format, tt.noHeader, got, tt.want)
+		}
+	}
+}
+
+// fileEvents are the events the capture writes besides the processes.
+var fileEvents = []string{
+	"VERSION", "CONTINUED", "DELETED", "KILL", "KILL DRY-RUN", "TIMEOUT", "RECONNECTED",
+	"WARNING", "CONNECTED", "DISCONNECTED", "SERVER CHANGED",
+}
+
+func TestDelimitedFilesHoldOnlyProcesses(t *testing.T) {
+	info := catch.ServerInfo{Hostname: "db1", Port: 3306, Version: "8.0.36", Flavor: "mysql"}
+	wait := catch.LockWait{WaitingID: 1, BlockingID: 2, Table: "`shop`.`orders`", LockMode: "X"}
+	plan := catch.Plan{Columns: []string{"id", "table"}, Rows: [][]sql.NullString{{{String: "1", Valid: true}, {}}}}
+
+	for _, format := range []string{formatCSV, formatTSV, formatSlowLog, formatGeneralLog} {
+		server, err := formatServerFile(info, format, "db1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lockWait, err := formatLockWaitFile(wait, format, "db1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		explain, err := formatPlanFile(1, "SELECT 1", plan, format, "db1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := map[string]string{"SERVER": server, "LOCK_WAIT": lockWait, "EXPLAIN": explain}
+		m := &monitor{c: &capture{opts: &options{}, format: format}, name: "db1"}
+		for _, event := range fileEvents {
+			events[event] = m.fileEvent(event, "message")
+		}
+		var kills strings.Builder
+		writer := bufio.NewWriter(&kills)
+		killLongQueries(context.Background(), nil, []catch.Process{{ID: 1, Command: "Query", Time: 60}}, 10, false, writer, format, "")
+		writer.Flush()
+		events["KILL DRY-RUN (killLongQueries)"] = kills.String()
+
+		for event, got := range events {
+			if isDelimited(format) && got != "" {
+				t.Errorf("%s: %s written as %q, want nothing", format, event, got)
+			}
+			if !isDelimited(format) && !strings.HasPrefix(got, "# ") {
+				t.Errorf("%s: %s written as %q, want a comment line", format, event, got)
+			}
+		}
+	}
+}
+
+// utf8mb4Statement has 4-byte emoji and 3-byte CJK characters, which a
+// connection without utf8mb4 would mangle.
+const utf8mb4Statement = "SELECT * FROM reviews WHERE body = '最高😀' AND city = '東京'"
+
+func TestFormatFileOutputUTF8MB4(t *testing.T) {
+	p := catch.Process{
+		ID:      7,
+		User:    "app",
+		Host:    "10.0.0.1:5000",
+		DB:      sql.NullString{String: "shop", Valid: true},
+		Command: "Query",
+		Info:    sql.NullString{String: utf8mb4Statement, Valid: true},
+	}
+
+	for _, format := range []string{formatText, formatJSON, formatCSV, formatTSV} {
+		out, err := formatFileOutput(p, format, "", "db1")
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		// The bytes the server sent are written as they are, not escaped
+		if !strings.Contains(out, utf8mb4Statement) {
+			t.Errorf("%s: output %q doesn't hold the statement bytes", format, out)
+		}
+	}
+
+	out, _ := formatFileOutput(p, formatJSON, "", "db1")
+	var record map[string]any
+	if err := json.Unmarshal([]byte(out), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["info"] != utf8mb4Statement {
+		t.Errorf("JSON info read back as %v, want %q", record["info"], utf8mb4Statement)
+	}
+
+	out, _ = formatFileOutput(p, formatCSV, "", "db1")
+	fields, err := csv.NewReader(strings.NewReader(out)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fields[len(fields)-1]; got != utf8mb4Statement {
+		t.Errorf("CSV info read back as %q, want %q", got, utf8mb4Statement)
+	}
+}
+
+func TestFormatProcessJSON(t *testing.T) {
+	p := catch.Process{
+		ID:      7,
+		User:    "app",
+		Command: "Query",
+		Time:    3,
+		Info:    sql.NullString{String: "SELECT 1", Valid: true},
+		TimeMS:  sql.NullInt64{Int64: 3120, Valid: true},
+	}
+	capturedAt := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	for _, server := range []string{"", "db1"} {
+		got, err := formatProcessJSON(p, server, "db1", capturedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(got), &record); err != nil {
+			t.Fatalf("%q: %v", got, err)
+		}
+		process, _ := json.Marshal(p)
+		var want map[string]any
+		json.Unmarshal(process, &want)
+		// catch.Process's own encoding, NULL columns and all, with the
+		// capture's fields
+		want["captured_at"] = "2024-01-01T14:00:00.000Z"
+		want["monitored_host"] = "db1"
+		if server != "" {
+			want["server"] = server
+		}
+		if !reflect.DeepEqual(record, want) {
+			t.Errorf("server %q: got %v, want %v", server, record, want)
+		}
+	}
+}
+
+func TestReplicaFile(t *testing.T) {
+	status := catch.ReplicaStatus{Source: "db1:3306", SecondsBehind: sql.NullInt64{Int64: 4, Valid: true}, IORunning: "Yes", SQLRunning: "Yes"}
+	for _, format := range []string{formatCSV, formatTSV} {
+		if got, err := formatReplicaFile(status, format, "db2"); err != nil || got != "" {
+			t.Errorf("%s: got %q, %v, want nothing", format, got, err)
+		}
+	}
+
+	got, err := formatReplicaFile(status, formatSlowLog, "db2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "# ") || !strings.Contains(got, "REPLICATION: db2 from db1:3306: lag 4s") {
+		t.Errorf("slow log: got %q, want a REPLICATION comment line", got)
+	}
+
+	got, err = formatReplicaFile(status, formatJSON, "db2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record replicaRecord
+	if err := json.Unmarshal([]byte(got), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Event != "REPLICATION" || record.SecondsBehind == nil || *record.SecondsBehind != 4 {
+		t.Errorf("JSON: got %+v", record)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// validateFileBase checks that -f names files rather than a path, so the
+// capture files stay in the output directory.
+func validateFileBase(name string) error {
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid -f %q: it is the start of the capture file names, use -output-dir for their directory", name)
+	}
+	return nil
+}
+
+// prepareOutputDir creates the -output-dir unless it exists, checks that
+// files can be created in it, and returns its absolute path. Without
+// -output-dir it is the current directory.
+func prepareOutputDir(dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return "", fmt.Errorf("creating -output-dir: %w", err)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	// Fail now rather than at the first poll
+	probe, err := os.CreateTemp(abs, ".go-catch-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot write capture files to %s: %w", abs, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return abs, nil
+}
+
+// captureFilePattern describes the names of the capture files written for
+// base, for the startup message.
+func captureFilePattern(opts *options, base string, multi bool) string {
+	ext := ".txt" + compressionExt(opts.CompressOutput)
+	if opts.Output == formatParquet {
+		ext = ".parquet"
+		base = strings.TrimSuffix(base, ext)
+	}
+	if multi && !opts.MergeOutput {
+		base += "-<host>"
+	}
+	return base + "-<date>" + ext
+}
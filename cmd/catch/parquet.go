@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow is the schema of -o parquet files. host is the monitored
+// server, the processlist HOST is client_host.
+type parquetRow struct {
+	CapturedAt time.Time `parquet:"captured_at,timestamp(millisecond)"`
+	Host       string    `parquet:"host"`
+	ID         int64     `parquet:"id"`
+	User       string    `parquet:"user"`
+	ClientHost string    `parquet:"client_host"`
+	DB         *string   `parquet:"db,optional"`
+	Command    string    `parquet:"command"`
+	Time       int32     `parquet:"time"`
+	TimeMS     *int64    `parquet:"time_ms,optional"`
+	State      *string   `parquet:"state,optional"`
+	Info       *string   `parquet:"info,optional"`
+}
+
+// parquetFile is an open -o parquet capture file. Parquet puts its index
+// in a footer written when the file is closed, so unlike the other
+// formats the file stays open between polls.
+type parquetFile struct {
+	name   string
+	file   *os.File
+	writer *parquet.GenericWriter[parquetRow]
+	// polls counts the polls written since the last row group
+	polls int
+}
+
+// createParquetFile starts the capture file name, which must not exist:
+// a closed Parquet file can't be appended to.
+func createParquetFile(name string) (*parquetFile, error) {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	writer := parquet.NewGenericWriter[parquetRow](file,
+		parquet.Compression(&parquet.Snappy),
+		// Unbuffered, so each row group is on disk once flushed
+		parquet.WriteBufferSize(0),
+		parquet.KeyValueMetadata("go-catch.version", versionString()))
+	return &parquetFile{name: name, file: file, writer: writer}, nil
+}
+
+// write adds the processes one poll of host captured at polledAt, ending
+// the row group every rowGroupPolls polls so it reaches the disk.
+func (f *parquetFile) write(host string, polledAt time.Time, processes []catch.Process, rowGroupPolls int) error {
+	rows := make([]parquetRow, len(processes))
+	for i, p := range processes {
+		rows[i] = parquetRow{
+			CapturedAt: polledAt,
+			Host:       host,
+			ID:         p.ID,
+			User:       p.User,
+			ClientHost: p.Host,
+			DB:         nullStringPtr(p.DB.String, p.DB.Valid),
+			Command:    p.Command,
+			Time:       int32(p.Time),
+			State:      nullStringPtr(p.State.String, p.State.Valid),
+			Info:       nullStringPtr(p.Info.String, p.Info.Valid),
+		}
+		if p.TimeMS.Valid {
+			rows[i].TimeMS = &p.TimeMS.Int64
+		}
+	}
+	if _, err := f.writer.Write(rows); err != nil {
+		return fmt.Errorf("writing %s: %w", f.name, err)
+	}
+
+	f.polls++
+	if f.polls < rowGroupPolls {
+		return nil
+	}
+	f.polls = 0
+	if err := f.writer.Flush(); err != nil {
+		return fmt.Errorf("writing %s: %w", f.name, err)
+	}
+	return nil
+}
+
+// Close writes the last row group and the footer, without which the file
+// can't be read.
+func (f *parquetFile) Close() error {
+	if err := f.writer.Close(); err != nil {
+		f.file.Close()
+		return fmt.Errorf("closing %s: %w", f.name, err)
+	}
+	return f.file.Close()
+}
+
+// nullStringPtr is nil for a NULL column, for the optional Parquet fields.
+func nullStringPtr(s string, valid bool) *string {
+	if !valid {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// promptPasswordFlag implements mysql's -p: given on its own it asks for the
+// password on the terminal, -p=secret uses the value directly.
+type promptPasswordFlag struct {
+	value  string
+	prompt bool
+}
+
+func (p *promptPasswordFlag) String() string { return "" }
+
+// IsBoolFlag lets -p be given without a value
+func (p *promptPasswordFlag) IsBoolFlag() bool { return true }
+
+func (p *promptPasswordFlag) Set(value string) error {
+	if value == "true" {
+		p.prompt = true
+		return nil
+	}
+	p.value = value
+	return nil
+}
+
+// promptPassword reads a password from the controlling terminal without
+// echoing it, so -p works when stdin is a pipe. It fails instead of blocking
+// when there is no terminal, e.g. under cron.
+func promptPassword() (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		// No controlling terminal, or a system without /dev/tty
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("-p needs a terminal to prompt for the password; use -p=<password>, $CATCH_PASSWORD or an option file instead")
+		}
+		tty = os.Stdin
+	} else {
+		defer tty.Close()
+	}
+
+	fmt.Fprint(tty, "Enter password: ")
+	password, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return string(password), nil
+}
+
+// readPasswordFile returns the first line of path, trimmed. Like ssh with
+// private keys, it refuses a file that other users can read.
+func readPasswordFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("reading -password-file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("reading -password-file: %w", err)
+	}
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		return "", fmt.Errorf("-password-file %s is readable by other users (mode %04o), restrict it with chmod 600", path, mode)
+	}
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("-password-file %s is empty", path)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// runPasswordCommand runs command with the shell and returns its trimmed
+// standard output. Its stdin and stderr are the terminal's, so tools such as
+// the 1Password CLI can ask to be unlocked. Errors never include the output.
+func runPasswordCommand(command string) (string, error) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("-password-command failed: %w", err)
+	}
+	password := strings.TrimSpace(string(out))
+	if password == "" {
+		return "", errors.New("-password-command printed no password")
+	}
+	return password, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// hasProcessPrivilege reports whether the connected account holds the
+// global PROCESS privilege, from SHOW GRANTS with the privileges of its
+// active roles. Without it the processlist silently lists only the
+// account's own sessions.
+func hasProcessPrivilege(ctx context.Context, db *sql.DB) (bool, error) {
+	// Servers without roles, such as MySQL 5.7, fail CURRENT_ROLE()
+	var roles sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT CURRENT_ROLE()").Scan(&roles); err != nil {
+		roles = sql.NullString{}
+	}
+
+	rows, err := db.QueryContext(ctx, grantsQuery(roles.String))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return false, err
+		}
+		if grantsProcess(grant) {
+			found = true
+		}
+	}
+	return found, rows.Err()
+}
+
+// grantsQuery is the SHOW GRANTS that lists the privileges of the account
+// and of roles, the CURRENT_ROLE() of a MySQL 8 session. Plain SHOW GRANTS
+// leaves out what MySQL 8 roles grant. MariaDB names a role without a host
+// and lists its privileges anyway, and NONE means no role is active.
+func grantsQuery(roles string) string {
+	if roles == "" || roles == "NONE" || !strings.Contains(roles, "@") {
+		return "SHOW GRANTS"
+	}
+	// As returned by the server, e.g. `monitor`@`%`,`reader`@`%`
+	return "SHOW GRANTS FOR CURRENT_USER() USING " + roles
+}
+
+// grantsProcess reports whether one SHOW GRANTS line grants PROCESS, which
+// only exists as a global privilege granted ON *.*.
+func grantsProcess(grant string) bool {
+	privileges, target, ok := strings.Cut(strings.ToUpper(grant), " ON ")
+	if !ok || !strings.HasPrefix(strings.TrimSpace(target), "*.*") {
+		return false
+	}
+	privileges = strings.TrimPrefix(privileges, "GRANT ")
+	for _, privilege := range strings.Split(privileges, ",") {
+		switch strings.TrimSpace(privilege) {
+		case "PROCESS", "ALL", "ALL PRIVILEGES":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestGrantsQuery(t *testing.T) {
+	tests := []struct {
+		roles string
+		want  string
+	}{
+		{"", "SHOW GRANTS"},
+		{"NONE", "SHOW GRANTS"},
+		{"monitor", "SHOW GRANTS"},
+		{"`monitor`@`%`", "SHOW GRANTS FOR CURRENT_USER() USING `monitor`@`%`"},
+		{"`monitor`@`%`,`reader`@`10.0.0.%`", "SHOW GRANTS FOR CURRENT_USER() USING `monitor`@`%`,`reader`@`10.0.0.%`"},
+	}
+	for _, tt := range tests {
+		if got := grantsQuery(tt.roles); got != tt.want {
+			t.Errorf("grantsQuery(%q) = %q, want %q", tt.roles, got, tt.want)
+		}
+	}
+}
+
+func TestGrantsProcess(t *testing.T) {
+	tests := []struct {
+		grant string
+		want  bool
+	}{
+		{"GRANT PROCESS ON *.* TO `app`@`%`", true},
+		{"GRANT SELECT, PROCESS, REPLICATION CLIENT ON *.* TO `app`@`%`", true},
+		{"GRANT ALL PRIVILEGES ON *.* TO `root`@`localhost` WITH GRANT OPTION", true},
+		{"GRANT USAGE ON *.* TO `app`@`%`", false},
+		{"GRANT ALL PRIVILEGES ON `shop`.* TO `app`@`%`", false},
+		// What a role's grants look like once USING lists them
+		{"GRANT `monitor`@`%` TO `app`@`%`", false},
+	}
+	for _, tt := range tests {
+		if got := grantsProcess(tt.grant); got != tt.want {
+			t.Errorf("grantsProcess(%q) = %v, want %v", tt.grant, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Backoff between reconnection attempts
+const (
+	reconnectInitialDelay = time.Second
+	reconnectMaxDelay     = 30 * time.Second
+)
+
+// isConnectionError reports whether err means the connection itself is
+// gone, as opposed to an error returned by the server for the statement.
+func isConnectionError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// The server answered, so the connection works
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// reconnect closes db and reopens the pool to addr with open, retrying with
+// capped exponential backoff until a ping succeeds, each bounded by
+// timeout. sleep waits between attempts and reports false on shutdown, in
+// which case reconnect gives up and returns false.
+func reconnect(ctx context.Context, db *sql.DB, open func() *sql.DB, addr string, timeout time.Duration, sleep func(time.Duration) bool) (*sql.DB, bool) {
+	delay := reconnectInitialDelay
+	for attempt := 1; ; attempt++ {
+		db.Close()
+		db = open()
+		pingCtx, cancel := withTimeout(ctx, timeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "%s RECONNECTED to %s after %d attempt(s)\n",
+				time.Now().Format("2006-01-02 15:04:05"), addr, attempt)
+			return db, true
+		}
+
+		if ctx.Err() != nil {
+			return db, false
+		}
+		fmt.Fprintf(os.Stderr, "%s Connection to %s lost (%v), reconnecting in %s (attempt %d)\n",
+			time.Now().Format("2006-01-02 15:04:05"), addr, err, delay, attempt)
+		if !sleep(delay) {
+			return db, false
+		}
+
+		delay *= 2
+		if delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// connectWithRetry runs testConnection, each attempt bounded by timeout,
+// retrying up to retries more times (forever when wait is set) with
+// interval between attempts. It gives up when ctx is cancelled.
+func connectWithRetry(ctx context.Context, db *sql.DB, addr, network string, retries int, interval, timeout time.Duration, wait bool) error {
+	yellow := color.New(color.FgYellow)
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := withTimeout(ctx, timeout)
+		err := testConnection(attemptCtx, db, addr, network)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || (!wait && attempt > retries) {
+			return err
+		}
+
+		if wait {
+			yellow.Printf("Retrying connection to %s (attempt %d): %v\n", addr, attempt+1, err)
+		} else {
+			yellow.Printf("Retrying connection to %s (attempt %d/%d): %v\n", addr, attempt+1, retries+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// replicaDiscoveryInterval is how often -with-replicas asks the sources for
+// their replicas again, to pick up replicas added during a capture.
+const replicaDiscoveryInterval = time.Minute
+
+// discoverReplicas lists the replicas registered with the server on db,
+// using SHOW REPLICAS and falling back to SHOW SLAVE HOSTS before MySQL
+// 8.0.22. Replicas only register a host when report_host is set on them.
+func discoverReplicas(ctx context.Context, db *sql.DB) (replicas []hostEntry, unnamed int, err error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICAS")
+	if err != nil {
+		if rows, err = db.QueryContext(ctx, "SHOW SLAVE HOSTS"); err != nil {
+			return nil, 0, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, 0, err
+	}
+	hostColumn, portColumn := -1, -1
+	for i, column := range columns {
+		switch strings.ToLower(column) {
+		case "host":
+			hostColumn = i
+		case "port":
+			portColumn = i
+		}
+	}
+	if hostColumn < 0 || portColumn < 0 {
+		return nil, 0, fmt.Errorf("unexpected replica columns %v", columns)
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+
+		host, port := values[hostColumn].String, values[portColumn].String
+		if host == "" {
+			unnamed++
+			continue
+		}
+		replicas = append(replicas, hostEntry{Host: net.JoinHostPort(host, port)})
+	}
+	return replicas, unnamed, rows.Err()
+}
+
+// watchReplicas monitors the replicas of sources alongside them until the
+// capture stops, rediscovering them every replicaDiscoveryInterval. A
+// replica that can't be reached is noted once and retried quietly at the
+// next discovery.
+func (c *capture) watchReplicas(sources []*monitor, build func(hostEntry) (*monitor, error)) {
+	// noted holds what was already reported, so each problem is only
+	// printed once
+	noted := map[string]bool{}
+	note := func(key, format string, args ...any) {
+		if !noted[key] {
+			noted[key] = true
+			c.print(fmt.Sprintf(format, args...))
+		}
+	}
+
+	for {
+		monitored := map[string]bool{}
+		for _, m := range c.active() {
+			monitored[m.entry.Host] = true
+		}
+
+		for _, source := range sources {
+			if source.state.Load() != stateConnected {
+				continue
+			}
+			// A pool of its own, source.db belongs to the polling goroutine
+			db := source.open()
+			ctx, cancel := c.connectContext()
+			replicas, unnamed, err := discoverReplicas(ctx, db)
+			cancel()
+			db.Close()
+			if err != nil {
+				note("discovery "+source.name, "%sWarning: cannot list replicas: %v\n", source.prefix(), err)
+				continue
+			}
+			if unnamed > 0 {
+				note(fmt.Sprintf("unnamed %s %d", source.name, unnamed),
+					"%sWarning: %d replica(s) registered without report_host, they can't be monitored\n",
+					source.prefix(), unnamed)
+			}
+
+			for _, entry := range replicas {
+				if monitored[entry.Host] {
+					continue
+				}
+				m, err := build(entry)
+				if err != nil {
+					note("replica "+entry.Host, "%sSkipping replica %s: %v\n", source.prefix(), entry.Host, err)
+					continue
+				}
+				m.db = m.open()
+				ctx, cancel := c.connectContext()
+				err = testConnection(ctx, m.db, m.name, m.cfg.Net)
+				cancel()
+				if err != nil {
+					m.db.Close()
+					note("replica "+entry.Host, "%sSkipping unreachable replica %s: %v\n", source.prefix(), entry.Host, err)
+					continue
+				}
+				m.state.Store(stateConnected)
+				m.added = true
+				monitored[entry.Host] = true
+				c.start(m)
+			}
+		}
+
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(replicaDiscoveryInterval):
+		}
+	}
+}
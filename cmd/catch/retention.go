@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// retentionAge is a -retention flag: a duration such as 12h, or whole days
+// such as 7d, which durations can't express.
+type retentionAge time.Duration
+
+func (a *retentionAge) String() string {
+	if *a == 0 {
+		return ""
+	}
+	return time.Duration(*a).String()
+}
+
+func (a *retentionAge) Set(value string) error {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid age %q, use e.g. 7d or 12h", value)
+		}
+		*a = retentionAge(time.Duration(n) * oneDay)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid age %q, use e.g. 7d or 12h", value)
+	}
+	*a = retentionAge(d)
+	return nil
+}
+
+func (a *retentionAge) Get() interface{} { return time.Duration(*a) }
+
+// retention deletes old capture files for -retention and -max-total-size.
+// Only files named like the ones this capture writes are ever considered.
+type retention struct {
+	maxAge   time.Duration
+	maxTotal int64
+	dryRun   bool
+	// dir holds the capture files, and pattern matches their names there.
+	// With perHost the names hold the file label of a monitored server,
+	// which the pattern's first group has to be.
+	dir     string
+	pattern *regexp.Regexp
+	perHost bool
+
+	mu sync.Mutex
+	// current is the file each monitor writes, never deleted
+	current map[*monitor]string
+}
+
+// prunedFile is a capture file deleted, or with -retention-dry-run to be
+// deleted.
+type prunedFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// newRetention returns the retention of the capture files named after -f,
+// or nil when neither -retention nor -max-total-size is set. perHost is
+// set when each server writes its own files.
+func newRetention(opts *options, parquet, perHost bool) *retention {
+	if opts.Retention == 0 && opts.MaxTotalSize == 0 {
+		return nil
+	}
+	base := opts.File
+	if base == "" {
+		base = "load_test"
+	}
+	if parquet {
+		base = strings.TrimSuffix(base, ".parquet")
+	}
+	// <base>[-<host>]-<date>[T<hour>[<minute>]][.<seq>].txt[.gz|.zst] or .parquet,
+	// the host only when each server writes its own files, so another
+	// capture's <base>-orders-<date>.txt isn't taken for one of ours
+	host := ""
+	if perHost {
+		host = `(.+)-`
+	}
+	pattern := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(base)) + `-` + host +
+		`\d{4}-\d{2}-\d{2}(?:T\d{2}|T\d{4})?(?:\.\d+)?\.(?:txt|txt\.gz|txt\.zst|parquet)$`)
+	return &retention{
+		maxAge:   time.Duration(opts.Retention),
+		maxTotal: int64(opts.MaxTotalSize),
+		dryRun:   opts.RetentionDryRun,
+		dir:      filepath.Dir(base),
+		pattern:  pattern,
+		perHost:  perHost,
+		current:  map[*monitor]string{},
+	}
+}
+
+// prune is called as m starts writing the capture file name. It deletes
+// the other capture files last written before the -retention window,
+// then, oldest first, those over the -max-total-size budget, which the
+// files being written count towards.
+func (r *retention) prune(m *monitor, name string, now time.Time) ([]prunedFile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current[m] = filepath.Clean(name)
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s for -retention: %w", r.dir, err)
+	}
+	hosts := map[string]bool{}
+	if r.perHost {
+		for _, monitor := range m.c.all() {
+			hosts[monitor.fileHost()] = true
+		}
+	}
+	var files []prunedFile
+	var total int64
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !r.matches(entry.Name(), hosts) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Deleted in the meantime
+			continue
+		}
+		total += info.Size()
+		path := filepath.Join(r.dir, entry.Name())
+		if !r.inUse(path) {
+			files = append(files, prunedFile{name: path, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+	slices.SortFunc(files, func(a, b prunedFile) int { return a.modTime.Compare(b.modTime) })
+
+	var pruned []prunedFile
+	for _, file := range files {
+		expired := r.maxAge > 0 && now.Sub(file.modTime) > r.maxAge
+		if !expired && (r.maxTotal <= 0 || total <= r.maxTotal) {
+			continue
+		}
+		if !r.dryRun {
+			if err := os.Remove(file.name); err != nil && !os.IsNotExist(err) {
+				color.New(color.FgRed).Fprintf(os.Stderr, "Error: -retention could not delete %s: %v\n", file.name, err)
+				continue
+			}
+		}
+		total -= file.size
+		pruned = append(pruned, file)
+	}
+	return pruned, nil
+}
+
+// matches reports whether name is one of the capture files, written for
+// one of hosts when each server writes its own files.
+func (r *retention) matches(name string, hosts map[string]bool) bool {
+	match := r.pattern.FindStringSubmatch(name)
+	if match == nil {
+		return false
+	}
+	return !r.perHost || hosts[match[1]]
+}
+
+// inUse reports whether a monitor is writing the capture file path.
+func (r *retention) inUse(path string) bool {
+	for _, name := range r.current {
+		if name == path {
+			return true
+		}
+	}
+	return false
+}
+
+// prune applies -retention as m starts writing the capture file name,
+// and returns the DELETED events to log in it.
+func (m *monitor) prune(name string) string {
+	r := m.c.retention
+	if r == nil {
+		return ""
+	}
+	pruned, err := r.prune(m, name, time.Now())
+	if err != nil {
+		color.New(color.FgRed).Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	var events string
+	for _, file := range pruned {
+		msg := fmt.Sprintf("%s, %s, last written %s", file.name, formatSize(file.size), file.modTime.Format("2006-01-02 15:04:05"))
+		if r.dryRun {
+			fmt.Printf("Retention dry run: would delete %s\n", msg)
+			continue
+		}
+		fmt.Printf("Retention: deleted %s\n", msg)
+		events += formatFileEvent(m.c.format, "DELETED", msg)
+	}
+	return events
+}
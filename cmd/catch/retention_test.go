@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetentionKeepsOtherCapturesFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-30 * oneDay)
+	for _, name := range []string{
+		"app-2024-01-01.txt",
+		"app-2024-01-01T14.2.txt.gz",
+		"app-db1-2024-01-01.txt",
+		"app-db2_3307-2024-01-01.txt",
+		// Another capture's -f app-orders
+		"app-orders-2024-01-01.txt",
+		"apps-2024-01-01.txt",
+	} {
+		path := writeOptionFile(t, dir, name, "")
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		multi bool
+		want  []string
+	}{
+		{"single host", false, []string{"app-2024-01-01.txt", "app-2024-01-01T14.2.txt.gz"}},
+		{"several hosts", true, []string{"app-db1-2024-01-01.txt", "app-db2_3307-2024-01-01.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &options{File: filepath.Join(dir, "app"), Retention: retentionAge(7 * oneDay), RetentionDryRun: true}
+			c := &capture{opts: opts, multi: tt.multi, retention: newRetention(opts, false, tt.multi)}
+			m := &monitor{c: c, entry: hostEntry{Host: "db1"}}
+			c.monitors = []*monitor{m, {c: c, entry: hostEntry{Host: "db2:3307"}}}
+
+			pruned, err := c.retention.prune(m, filepath.Join(dir, "app-new.txt"), time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, file := range pruned {
+				got = append(got, filepath.Base(file.name))
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pruned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// oneDay is the default rotation: one capture file per calendar day
+const oneDay = 24 * time.Hour
+
+// validateRotateInterval accepts intervals that divide a day, so every day
+// starts at a boundary.
+func validateRotateInterval(interval time.Duration) error {
+	if interval == 0 {
+		return nil
+	}
+	if interval < time.Minute || interval > oneDay || oneDay%interval != 0 {
+		return fmt.Errorf("invalid -rotate-interval %s: it must divide a day evenly, e.g. 15m, 1h or 6h", interval)
+	}
+	return nil
+}
+
+// intervalStart is the start of the -rotate-interval t falls in, counted
+// from local midnight.
+func intervalStart(t time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.Add(t.Sub(midnight) / interval * interval)
+}
+
+// nextRotation is when the capture file after the one for t begins.
+func nextRotation(t time.Time, interval time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+	if interval <= 0 {
+		return midnight
+	}
+	next := intervalStart(t, interval).Add(interval)
+	// A day shortened by a DST change still ends at midnight
+	if next.After(midnight) {
+		return midnight
+	}
+	return next
+}
+
+// fileStamp dates the capture file for t: the day, and with a
+// -rotate-interval under a day the start of the interval, hours only when
+// it is whole hours, e.g. 2024-05-01T14 or 2024-05-01T1415.
+func fileStamp(t time.Time, interval time.Duration) string {
+	if interval <= 0 || interval >= oneDay {
+		return t.Format("2006-01-02")
+	}
+	start := intervalStart(t, interval)
+	if interval%time.Hour == 0 {
+		return start.Format("2006-01-02T15")
+	}
+	return start.Format("2006-01-02T1504")
+}
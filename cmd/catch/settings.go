@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Where a connection setting came from, in precedence order
+const (
+	sourceFlag       = "flag"
+	sourceEnv        = "environment"
+	sourceOptionFile = "option file"
+	sourceDefault    = "default"
+
+	// Flags whose password was read by main, reported as the source
+	sourcePasswordFile    = "-password-file"
+	sourcePasswordCommand = "-password-command"
+)
+
+// setting is a resolved connection parameter and where it came from.
+type setting struct {
+	Value  string
+	Source string
+}
+
+// pick returns the first candidate with a value.
+func pick(candidates ...setting) setting {
+	for _, c := range candidates {
+		if c.Value != "" {
+			return c
+		}
+	}
+	return setting{Source: sourceDefault}
+}
+
+func fromEnv(name string) setting {
+	return setting{Value: os.Getenv(name), Source: sourceEnv + " " + name}
+}
+
+// connectionSettings are the resolved credentials and address used to connect.
+type connectionSettings struct {
+	User     setting
+	Password setting
+	Host     setting
+	Port     setting
+	Socket   setting
+	SSLMode  setting
+	SSLCA    setting
+	SSLCert  setting
+	SSLKey   setting
+}
+
+// connectionFlags are the command line values that override everything else.
+type connectionFlags struct {
+	User     string
+	Password string
+	// PasswordSource names the flag the password came from, sourceFlag
+	// when empty
+	PasswordSource string
+	Host           string
+	Port           string
+	Socket         string
+	SSLMode        string
+	SSLCA          string
+	SSLCert        string
+	SSLKey         string
+}
+
+// resolveSettings applies the precedence flags > environment > option file >
+// built-in defaults. USER is only a default since login shells always set it.
+// A port given as part of the host, as in -h db1:3307, takes the host's
+// place in that order.
+func resolveSettings(flags connectionFlags, config MySQLConfig) connectionSettings {
+	osUser := os.Getenv("USER")
+	if u, err := user.Current(); err == nil && osUser == "" {
+		osUser = u.Username
+	}
+
+	passwordSource := sourceFlag
+	if flags.PasswordSource != "" {
+		passwordSource = flags.PasswordSource
+	}
+
+	s := connectionSettings{
+		User: pick(
+			setting{flags.User, sourceFlag},
+			setting{config.User, sourceOptionFile},
+			setting{osUser, sourceDefault},
+		),
+		Password: pick(
+			setting{flags.Password, passwordSource},
+			// Our own variable wins, so it can differ from the mysql client's
+			fromEnv("CATCH_PASSWORD"),
+			fromEnv("MYSQL_PWD"),
+			setting{config.Password, sourceOptionFile},
+		),
+		Host: pick(
+			setting{flags.Host, sourceFlag},
+			fromEnv("MYSQL_HOST"),
+			setting{config.Host, sourceOptionFile},
+			setting{"localhost", sourceDefault},
+		),
+		Port: pick(
+			setting{flags.Port, sourceFlag},
+			fromEnv("MYSQL_TCP_PORT"),
+			setting{config.Port, sourceOptionFile},
+			setting{defaultPort, sourceDefault},
+		),
+		Socket: pick(
+			setting{flags.Socket, sourceFlag},
+			fromEnv("MYSQL_UNIX_PORT"),
+			setting{config.Socket, sourceOptionFile},
+		),
+		SSLMode: pick(setting{flags.SSLMode, sourceFlag}, setting{config.SSLMode, sourceOptionFile}),
+		SSLCA:   pick(setting{flags.SSLCA, sourceFlag}, setting{config.SSLCA, sourceOptionFile}),
+		SSLCert: pick(setting{flags.SSLCert, sourceFlag}, setting{config.SSLCert, sourceOptionFile}),
+		SSLKey:  pick(setting{flags.SSLKey, sourceFlag}, setting{config.SSLKey, sourceOptionFile}),
+	}
+
+	host, port := splitHostPort(s.Host.Value)
+	s.Host.Value = host
+	if port != "" && sourceRank(s.Host.Source) <= sourceRank(s.Port.Source) {
+		s.Port = setting{port, s.Host.Source}
+	}
+	return s
+}
+
+// sourceRank orders sources by precedence; a lower rank wins.
+func sourceRank(source string) int {
+	switch {
+	case source == sourceFlag:
+		return 0
+	case strings.HasPrefix(source, sourceEnv):
+		return 1
+	case source == sourceOptionFile:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// describe reports where each setting came from, without the password itself.
+func (s connectionSettings) describe() string {
+	parts := []string{
+		fmt.Sprintf("user=%s (%s)", s.User.Value, s.User.Source),
+		fmt.Sprintf("host=%s (%s)", s.Host.Value, s.Host.Source),
+		fmt.Sprintf("port=%s (%s)", s.Port.Value, s.Port.Source),
+	}
+	if s.Socket.Value != "" {
+		parts = append(parts, fmt.Sprintf("socket=%s (%s)", s.Socket.Value, s.Socket.Source))
+	}
+	if s.SSLMode.Value != "" {
+		parts = append(parts, fmt.Sprintf("ssl-mode=%s (%s)", s.SSLMode.Value, s.SSLMode.Source))
+	}
+	if s.Password.Value != "" {
+		parts = append(parts, fmt.Sprintf("password set (%s)", s.Password.Source))
+	} else {
+		parts = append(parts, "no password")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// loadOptionFiles reads the option files selected by opts, returning the
+// config and the groups that were read.
+func loadOptionFiles(opts *options) (MySQLConfig, []string, error) {
+	groups := defaultOptionGroups
+	if opts.Groups != "" {
+		groups = splitList(opts.Groups)
+	}
+	groups = withGroupSuffix(groups, opts.GroupSuffix)
+
+	config, err := readMySQLConfig(optionSource{
+		DefaultsFile:      opts.DefaultsFile,
+		DefaultsExtraFile: opts.DefaultsExtraFile,
+		UserFile:          userOptionFile(),
+		LoginFile:         loginFilePath(),
+		LoginPath:         opts.LoginPath,
+	}, groups)
+	if opts.LoginPath != "" {
+		groups = append(groups, opts.LoginPath)
+	}
+	return config, groups, err
+}
+
+// resolveDriverConfig builds the driver config from -dsn when given, and
+// otherwise from flags, environment and option files. The returned label
+// names the server in messages and never contains the password.
+func resolveDriverConfig(opts *options, config MySQLConfig) (*mysql.Config, string, error) {
+	if opts.DSN != "" {
+		cfg, err := mysql.ParseDSN(opts.DSN)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid -dsn: %w", err)
+		}
+		applyRequiredParams(cfg)
+		if err := configureCompression(cfg, opts.Compress); err != nil {
+			return nil, "", err
+		}
+		if err := configureAuth(cfg, authOptions{
+			Cleartext:           opts.EnableCleartext,
+			FallbackToPlaintext: opts.PlaintextFallback,
+			ServerPublicKey:     opts.ServerPubKeyPath,
+		}); err != nil {
+			return nil, "", err
+		}
+		// Without the flags, charset and collation in the DSN are kept
+		if opts.Charset != "" || opts.Collation != "" {
+			if err := configureCharset(cfg, opts.Charset, opts.Collation); err != nil {
+				return nil, "", err
+			}
+		}
+		return cfg, redactDSN(cfg), nil
+	}
+
+	port := ""
+	if opts.Port != 0 {
+		port = strconv.Itoa(opts.Port)
+	}
+	password := opts.Password
+	if opts.Prompt.value != "" {
+		password = opts.Prompt.value
+	}
+	passwordSource := ""
+	switch {
+	case opts.PasswordFile != "":
+		passwordSource = sourcePasswordFile
+	case opts.PasswordCommand != "":
+		passwordSource = sourcePasswordCommand
+	}
+
+	settings := resolveSettings(connectionFlags{
+		User:           opts.User,
+		Password:       password,
+		PasswordSource: passwordSource,
+		Host:           opts.Host,
+		Port:           port,
+		Socket:         opts.Socket,
+		SSLMode:        opts.SSLMode,
+		SSLCA:          opts.SSLCA,
+		SSLCert:        opts.SSLCert,
+		SSLKey:         opts.SSLKey,
+	}, config)
+	if opts.Verbose {
+		fmt.Printf("Connection settings: %s\n", settings.describe())
+	}
+
+	ep, err := resolveEndpoint(settings.Host.Value, settings.Port.Value, settings.Socket)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid connection settings for %s: %w",
+			net.JoinHostPort(settings.Host.Value, settings.Port.Value), err)
+	}
+
+	cfg := buildDriverConfig(settings, ep)
+	ssl := sslOptions{
+		Mode: settings.SSLMode.Value,
+		CA:   settings.SSLCA.Value,
+		Cert: settings.SSLCert.Value,
+		Key:  settings.SSLKey.Value,
+	}
+	if opts.AWSIAMAuth {
+		var err error
+		if ssl, err = iamSSLOptions(ssl); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := configureTLS(cfg, ssl, settings.Host.Value); err != nil {
+		return nil, "", err
+	}
+	if opts.AWSIAMAuth {
+		if err := configureIAMAuth(cfg, settings.Host.Value, settings.Port.Value, opts.AWSRegion); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := configureCompression(cfg, opts.Compress || config.Compress); err != nil {
+		return nil, "", err
+	}
+	publicKey := opts.ServerPubKeyPath
+	if publicKey == "" {
+		publicKey = config.ServerPublicKeyPath
+	}
+	if err := configureAuth(cfg, authOptions{
+		Cleartext:           opts.EnableCleartext || config.EnableCleartextPlugin,
+		FallbackToPlaintext: opts.PlaintextFallback,
+		ServerPublicKey:     publicKey,
+	}); err != nil {
+		return nil, "", err
+	}
+	charset := opts.Charset
+	if charset == "" {
+		charset = config.Charset
+	}
+	if err := configureCharset(cfg, charset, opts.Collation); err != nil {
+		return nil, "", err
+	}
+	return cfg, ep.Address, nil
+}
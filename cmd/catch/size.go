@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteSize is a size flag such as 100MB. Units are powers of 1024 and a
+// bare number is in bytes.
+type byteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"GB", 1 << 30}, {"G", 1 << 30},
+	{"MB", 1 << 20}, {"M", 1 << 20},
+	{"KB", 1 << 10}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+func (s *byteSize) String() string {
+	if *s == 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64(*s), 10)
+}
+
+func (s *byteSize) Set(value string) error {
+	number, scale := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+	for _, unit := range sizeUnits {
+		if trimmed, ok := strings.CutSuffix(number, unit.suffix); ok {
+			number, scale = strings.TrimSpace(trimmed), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, use e.g. 500KB, 100MB or 1GB", value)
+	}
+	*s = byteSize(n * scale)
+	return nil
+}
+
+// formatSize renders n bytes with the largest unit that keeps it at 1 or
+// more, e.g. 1.5MB.
+func formatSize(n int64) string {
+	for _, unit := range sizeUnits {
+		if unit.scale > 1 && len(unit.suffix) == 2 && n >= unit.scale {
+			return strconv.FormatFloat(float64(n)/float64(unit.scale), 'f', 1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
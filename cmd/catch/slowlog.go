@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// runningStatement is the last observation of a statement.
+type runningStatement struct {
+	process  catch.Process
+	lastSeen time.Time
+	// seen is set when the statement was observed by the current poll
+	seen bool
+}
+
+// slowLog turns observed statements into slow query log entries for
+// -o slowlog, writing each statement once when it is no longer running
+// instead of once per poll.
+type slowLog struct {
+	running map[statementKey]*runningStatement
+}
+
+func newSlowLog() *slowLog {
+	return &slowLog{running: map[statementKey]*runningStatement{}}
+}
+
+// observe records that p was running at now. Idle connections have no
+// statement to log.
+func (l *slowLog) observe(p catch.Process, now time.Time) {
+	if p.Info.String == "" {
+		return
+	}
+	key := statementKey{p.ID, p.Info.String}
+	s := l.running[key]
+	if s == nil {
+		s = &runningStatement{}
+		l.running[key] = s
+	}
+	s.process = p
+	s.lastSeen = now
+	s.seen = true
+}
+
+// finished renders the statements the last poll no longer saw, or all of
+// them with all, and forgets them.
+func (l *slowLog) finished(all bool) string {
+	var done []*runningStatement
+	for key, s := range l.running {
+		if s.seen && !all {
+			s.seen = false
+			continue
+		}
+		done = append(done, s)
+		delete(l.running, key)
+	}
+	sort.Slice(done, func(i, j int) bool {
+		if !done[i].lastSeen.Equal(done[j].lastSeen) {
+			return done[i].lastSeen.Before(done[j].lastSeen)
+		}
+		return done[i].process.ID < done[j].process.ID
+	})
+
+	var b strings.Builder
+	for _, s := range done {
+		b.WriteString(formatSlowLogEntry(s.process, s.lastSeen))
+	}
+	return b.String()
+}
+
+// formatSlowLogEntry renders p, last seen running at lastSeen, in the
+// MySQL slow query log syntax that pt-query-digest reads. The final TIME
+// stands in for Query_time, which is why it is a whole number of seconds.
+func formatSlowLogEntry(p catch.Process, lastSeen time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Time: %s\n", lastSeen.UTC().Format("2006-01-02T15:04:05.000000Z"))
+
+	// The server logs a client address as "@ [ip]" and a name as "@ name []"
+	host := p.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	client := host + " []"
+	if net.ParseIP(host) != nil {
+		client = " [" + host + "]"
+	}
+	fmt.Fprintf(&b, "# User@Host: %s[%s] @ %s  Id: %d\n", p.User, p.User, client, p.ID)
+	fmt.Fprintf(&b, "# Query_time: %d.000000  Lock_time: 0.000000 Rows_sent: 0  Rows_examined: %d\n",
+		p.Time, p.RowsExamined.Int64)
+
+	if p.DB.String != "" {
+		fmt.Fprintf(&b, "use %s;\n", p.DB.String)
+	}
+	started := lastSeen.Add(-time.Duration(p.Time) * time.Second)
+	fmt.Fprintf(&b, "SET timestamp=%d;\n", started.Unix())
+	statement := strings.TrimSpace(p.Info.String)
+	if !strings.HasSuffix(statement, ";") {
+		statement += ";"
+	}
+	b.WriteString(statement + "\n")
+	return b.String()
+}
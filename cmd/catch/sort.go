@@ -0,0 +1,75 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// sortFields are the -sort fields, in the order listed in messages
+var sortFields = []string{"time", "user", "db", "id"}
+
+// processOrder is a parsed -sort value.
+type processOrder struct {
+	field string
+	desc  bool
+}
+
+// parseSort reads a -sort value, field[:asc|:desc]. The longest running
+// processes come first by default, everything else in ascending order.
+func parseSort(value string) (processOrder, error) {
+	if value == "" {
+		return processOrder{field: "time", desc: true}, nil
+	}
+	field, dir, hasDir := strings.Cut(strings.ToLower(value), ":")
+	if !slices.Contains(sortFields, field) {
+		return processOrder{}, fmt.Errorf("invalid -sort %q: unknown field %q (valid: %s, each optionally with :asc or :desc)",
+			value, field, strings.Join(sortFields, ", "))
+	}
+	order := processOrder{field: field, desc: field == "time"}
+	if hasDir {
+		switch dir {
+		case "asc":
+			order.desc = false
+		case "desc":
+			order.desc = true
+		default:
+			return processOrder{}, fmt.Errorf("invalid -sort %q: direction must be asc or desc", value)
+		}
+	}
+	return order, nil
+}
+
+// sort orders processes in place. Ties keep the processlist order, longest
+// running first.
+func (o processOrder) sort(processes []catch.Process) {
+	slices.SortStableFunc(processes, func(a, b catch.Process) int {
+		var c int
+		switch o.field {
+		case "time":
+			c = cmp.Compare(runningMS(a), runningMS(b))
+		case "user":
+			c = cmp.Compare(a.User, b.User)
+		case "db":
+			c = cmp.Compare(a.DB.String, b.DB.String)
+		case "id":
+			c = cmp.Compare(a.ID, b.ID)
+		}
+		if o.desc {
+			c = -c
+		}
+		return c
+	})
+}
+
+// runningMS is how long p has been running in milliseconds, as precise as
+// the server reports it.
+func runningMS(p catch.Process) int64 {
+	if p.TimeMS.Valid {
+		return p.TimeMS.Int64
+	}
+	return int64(p.Time) * 1000
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePrefix starts the -o value that stores captures in a SQLite
+// database, as in -o sqlite:captures.db
+const sqlitePrefix = "sqlite:"
+
+// sqliteSchemaVersion is the version of the schema below, recorded in the
+// meta table so later releases can migrate older databases
+const sqliteSchemaVersion = 1
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS meta (
+		key   TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS captures (
+		poll_ts     TEXT NOT NULL,
+		host        TEXT NOT NULL,
+		process_id  INTEGER NOT NULL,
+		user        TEXT NOT NULL,
+		client_host TEXT NOT NULL,
+		db          TEXT,
+		command     TEXT NOT NULL,
+		time        INTEGER NOT NULL,
+		state       TEXT,
+		info        TEXT,
+		digest      TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS captures_poll_ts ON captures (poll_ts)`,
+	`CREATE INDEX IF NOT EXISTS captures_digest ON captures (digest)`,
+}
+
+// sqliteStore writes captured processes into a SQLite database, one
+// transaction per poll.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStore opens or creates the database at path. It is put in WAL
+// mode, so it can be queried while the capture is running.
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer; the monitors take turns on one connection
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range append([]string{"PRAGMA journal_mode = WAL", "PRAGMA busy_timeout = 5000"}, sqliteSchema...) {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("setting up %s: %w", path, err)
+		}
+	}
+
+	var version string
+	err = db.QueryRow("SELECT value FROM meta WHERE key = 'schema_version'").Scan(&version)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Exec("INSERT INTO meta (key, value) VALUES ('schema_version', ?)", strconv.Itoa(sqliteSchemaVersion))
+	case err == nil:
+		if n, _ := strconv.Atoi(version); n > sqliteSchemaVersion {
+			err = fmt.Errorf("schema version %s was written by a newer go-catch, this one knows version %d", version, sqliteSchemaVersion)
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// insertPoll stores the processes one poll of host captured at polledAt.
+func (s *sqliteStore) insertPoll(host string, polledAt time.Time, processes []catch.Process) error {
+	if len(processes) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO captures
+		(poll_ts, host, process_id, user, client_host, db, command, time, state, info, digest)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// UTC, so the text sorts in time order
+	ts := polledAt.UTC().Format(jsonTimeFormat)
+	for _, p := range processes {
+		var digest sql.NullString
+		if strings.TrimSpace(p.Info.String) != "" {
+			digest = sql.NullString{String: catch.Digest(p.Info.String), Valid: true}
+		}
+		_, err := stmt.Exec(ts, host, p.ID, p.User, p.Host, p.DB, p.Command, p.Time, p.State, p.Info, digest)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/fatih/color"
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	// storeQueueRows bounds the rows held while the -store-dsn server is
+	// unreachable; the rows of polls beyond it are dropped
+	storeQueueRows = 100000
+	// storeInsertRows is the number of rows per INSERT, which keeps a
+	// large poll under max_allowed_packet
+	storeInsertRows = 500
+	// storeRetryInterval is the wait before a failed insert is retried
+	storeRetryInterval = 5 * time.Second
+	// storeFlushTimeout bounds the wait for the queued rows at exit
+	storeFlushTimeout = 10 * time.Second
+)
+
+// storeTableName is a table, optionally qualified by its database
+var storeTableName = regexp.MustCompile(`^[A-Za-z0-9_$]+(\.[A-Za-z0-9_$]+)?$`)
+
+const storeSchema = `CREATE TABLE IF NOT EXISTS %s (
+	id          BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	poll_ts     DATETIME(3) NOT NULL,
+	host        VARCHAR(255) NOT NULL,
+	process_id  BIGINT UNSIGNED NOT NULL,
+	user        VARCHAR(255) NOT NULL,
+	client_host VARCHAR(255) NOT NULL,
+	db          VARCHAR(255),
+	command     VARCHAR(64) NOT NULL,
+	time        BIGINT NOT NULL,
+	state       VARCHAR(1024),
+	info        LONGTEXT,
+	digest      CHAR(32),
+	KEY poll_ts (poll_ts),
+	KEY digest (digest)
+)`
+
+// storeBatch is the processes one poll of host captured at polledAt.
+type storeBatch struct {
+	host      string
+	polledAt  time.Time
+	processes []catch.Process
+}
+
+// mysqlStore appends captured processes to a table on another MySQL
+// server, for -store-dsn. Polls are queued and inserted in the background,
+// so a store that is slow or away never holds up a poll.
+type mysqlStore struct {
+	db *sql.DB
+	// table is the quoted -store-table
+	table string
+	// server identifies the store, to refuse monitoring it
+	server catch.ServerInfo
+
+	mu     sync.Mutex
+	queue  []storeBatch
+	queued int // rows in queue
+	// dropped counts the rows that didn't fit in the queue
+	dropped atomic.Int64
+
+	// wake is signaled by enqueue, closing by Close, and done is closed
+	// once the queue is written or given up on
+	wake    chan struct{}
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// openMySQLStore connects to the server of dsn and creates table there
+// unless it exists.
+func openMySQLStore(ctx context.Context, dsn, table string, opts *options) (*mysqlStore, error) {
+	if !storeTableName.MatchString(table) {
+		return nil, fmt.Errorf("invalid -store-table %q, expected a table name, optionally as database.table", table)
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -store-dsn: %w", err)
+	}
+	applyTimeouts(cfg, opts.ConnectTimeout, opts.ReadTimeout, opts.WriteTimeout)
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -store-dsn: %w", err)
+	}
+	db := sql.OpenDB(connector)
+	// The writer inserts one poll at a time
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	s := &mysqlStore{
+		db:      db,
+		table:   quoteTableName(table),
+		wake:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if s.server, err = catch.DetectServer(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to the -store-dsn server: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(storeSchema, s.table)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating -store-table %s: %w", table, err)
+	}
+	go s.run()
+	return s, nil
+}
+
+// quoteTableName quotes each part of database.table.
+func quoteTableName(table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = "`" + part + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+// isServer reports whether info is the store server itself. MariaDB has no
+// server_uuid, so it is told apart by its hostname and port.
+func (s *mysqlStore) isServer(info catch.ServerInfo) bool {
+	if info.UUID != "" && s.server.UUID != "" {
+		return info.UUID == s.server.UUID
+	}
+	return info.Hostname != "" && info.Hostname == s.server.Hostname && info.Port == s.server.Port
+}
+
+// enqueue queues the processes of one poll, dropping them when the queue
+// is full.
+func (s *mysqlStore) enqueue(host string, polledAt time.Time, processes []catch.Process) {
+	if len(processes) == 0 {
+		return
+	}
+	s.mu.Lock()
+	if s.queued+len(processes) > storeQueueRows {
+		s.mu.Unlock()
+		s.dropped.Add(int64(len(processes)))
+		return
+	}
+	s.queue = append(s.queue, storeBatch{host: host, polledAt: polledAt, processes: processes})
+	s.queued += len(processes)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the oldest queued poll.
+func (s *mysqlStore) next() (storeBatch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		return storeBatch{}, false
+	}
+	return s.queue[0], true
+}
+
+// pop removes the oldest queued poll once it is stored, or with dropped
+// counts its rows as dropped.
+func (s *mysqlStore) pop(dropped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.queue[0].processes)
+	s.queue = s.queue[1:]
+	s.queued -= n
+	if dropped {
+		s.dropped.Add(int64(n))
+	}
+}
+
+// stats describes the queue for the periodic stats line.
+func (s *mysqlStore) stats() string {
+	s.mu.Lock()
+	queued := s.queued
+	s.mu.Unlock()
+	return fmt.Sprintf("store: %d rows queued, %d dropped", queued, s.dropped.Load())
+}
+
+// run inserts the queued polls in order until Close, retrying while the
+// server is unreachable. At Close it keeps going until the queue is empty
+// or storeFlushTimeout has passed.
+func (s *mysqlStore) run() {
+	defer close(s.done)
+	closing := s.closing
+	var deadline <-chan time.Time
+	failing := false
+	for {
+		batch, ok := s.next()
+		if !ok {
+			if closing == nil {
+				return
+			}
+			select {
+			case <-s.wake:
+			case <-closing:
+				closing = nil
+				deadline = time.After(storeFlushTimeout)
+			}
+			continue
+		}
+
+		if err := s.insert(batch); err != nil {
+			if !failing {
+				color.New(color.FgRed, color.Bold).Fprintf(os.Stderr,
+					"Warning: storing captures failed, queueing them and retrying every %s: %v\n", storeRetryInterval, err)
+				failing = true
+			}
+			select {
+			case <-time.After(storeRetryInterval):
+			case <-closing:
+				closing = nil
+				deadline = time.After(storeFlushTimeout)
+			case <-deadline:
+				for {
+					if _, ok := s.next(); !ok {
+						return
+					}
+					s.pop(true)
+				}
+			}
+			continue
+		}
+		if failing {
+			fmt.Fprintln(os.Stderr, "Storing captures again")
+			failing = false
+		}
+		s.pop(false)
+	}
+}
+
+// insert stores one poll in a transaction, with multi-row INSERTs.
+func (s *mysqlStore) insert(batch storeBatch) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(batch.processes); start += storeInsertRows {
+		chunk := batch.processes[start:min(start+storeInsertRows, len(batch.processes))]
+		args := make([]interface{}, 0, len(chunk)*11)
+		for _, p := range chunk {
+			var digest sql.NullString
+			if strings.TrimSpace(p.Info.String) != "" {
+				digest = sql.NullString{String: catch.Digest(p.Info.String), Valid: true}
+			}
+			args = append(args, batch.polledAt.UTC(), batch.host, p.ID, p.User, p.Host, p.DB, p.Command, p.Time, p.State, p.Info, digest)
+		}
+		query := "INSERT INTO " + s.table +
+			" (poll_ts, host, process_id, user, client_host, db, command, time, state, info, digest) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(chunk)), ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close writes out the queue, as far as storeFlushTimeout allows, and
+// closes the connection. It returns the number of rows dropped in all.
+func (s *mysqlStore) Close() int64 {
+	close(s.closing)
+	<-s.done
+	s.db.Close()
+	return s.dropped.Load()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// pollSummary is the -summary rollup of one poll.
+type pollSummary struct {
+	server    string
+	total     int
+	maxTime   int
+	totalTime int
+	byType    map[string]int
+	byUser    map[string]int
+}
+
+// summarize rolls up one poll of server, which is empty when only one
+// server is monitored.
+func summarize(server string, processes []catch.Process) pollSummary {
+	s := pollSummary{server: server, byType: map[string]int{}, byUser: map[string]int{}}
+	for _, p := range processes {
+		s.total++
+		s.totalTime += p.Time
+		if p.Time > s.maxTime {
+			s.maxTime = p.Time
+		}
+		s.byType[catch.ClassifyQuery(p.Info.String).String()]++
+		s.byUser[p.User]++
+	}
+	return s
+}
+
+// sortedCounts formats counts as "key=n" pairs, largest first.
+func sortedCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%d", key, counts[key])
+	}
+	return strings.Join(pairs, " ")
+}
+
+func (s pollSummary) String() string {
+	avg := 0.0
+	if s.total > 0 {
+		avg = float64(s.totalTime) / float64(s.total)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*************************** Summary @ %s ***************************\n",
+		time.Now().Format("2006-01-02 15:04:05"))
+	if s.server != "" {
+		fmt.Fprintf(&b, "   SERVER: %s\n", s.server)
+	}
+	fmt.Fprintf(&b, "PROCESSES: %d\n", s.total)
+	fmt.Fprintf(&b, " MAX TIME: %d\n", s.maxTime)
+	fmt.Fprintf(&b, " AVG TIME: %.1f\n", avg)
+	fmt.Fprintf(&b, "  BY TYPE: %s\n", sortedCounts(s.byType))
+	fmt.Fprintf(&b, "  BY USER: %s\n\n", sortedCounts(s.byUser))
+	return b.String()
+}
+
+// userLoad is one row of the -by-user table.
+type userLoad struct {
+	user        string
+	connections int
+	totalTime   int
+}
+
+// formatUserTable renders the connection count and summed TIME of each
+// user, most connections first, with a total row. server, when set, names
+// the monitored server.
+func formatUserTable(processes []catch.Process, server string) string {
+	byUser := map[string]*userLoad{}
+	var users []*userLoad
+	total := userLoad{user: "TOTAL"}
+	for _, p := range processes {
+		load := byUser[p.User]
+		if load == nil {
+			load = &userLoad{user: p.User}
+			byUser[p.User] = load
+			users = append(users, load)
+		}
+		load.connections++
+		load.totalTime += p.Time
+		total.connections++
+		total.totalTime += p.Time
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].connections != users[j].connections {
+			return users[i].connections > users[j].connections
+		}
+		return users[i].user < users[j].user
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*************************** Users @ %s ***************************\n",
+		time.Now().Format("2006-01-02 15:04:05"))
+	if server != "" {
+		fmt.Fprintf(&b, "   SERVER: %s\n", server)
+	}
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tCONNECTIONS\tTOTAL TIME\t")
+	for _, load := range append(users, &total) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t\n", load.user, load.connections, load.totalTime)
+	}
+	w.Flush()
+	b.WriteString("\n")
+	return b.String()
+}
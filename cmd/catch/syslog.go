@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/fatih/color"
+)
+
+// syslogTag is the program name of the -syslog messages. With several
+// hosts each one's messages are tagged go-catch-<host>, so receivers can
+// route them apart.
+const syslogTag = "go-catch"
+
+// syslogWriter is a connection to a syslog daemon.
+type syslogWriter interface {
+	Info(message string) error
+	Close() error
+}
+
+// syslogSink sends each captured process to syslog as one message, for
+// -syslog. Without syslog the messages go to stderr instead.
+type syslogSink struct {
+	mu sync.Mutex
+	// dial connects with a tag, nil when syslog couldn't be reached at
+	// startup
+	dial    func(tag string) (syslogWriter, error)
+	writers map[string]syslogWriter
+	// failing is set while sending fails, to warn once
+	failing bool
+}
+
+// openSyslog connects to the local syslog daemon, or with addr to a
+// remote one, falling back to stderr when it can't be reached. Only an
+// invalid addr is an error.
+func openSyslog(addr string) (*syslogSink, error) {
+	network, raddr, err := parseSyslogAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	dial := func(tag string) (syslogWriter, error) { return dialSyslog(network, raddr, tag) }
+	writer, err := dial(syslogTag)
+	if err == nil {
+		return &syslogSink{dial: dial, writers: map[string]syslogWriter{syslogTag: writer}}, nil
+	}
+	where := "the local syslog"
+	if addr != "" {
+		where = "syslog at " + addr
+	}
+	color.New(color.FgRed, color.Bold).Fprintf(os.Stderr,
+		"Error: cannot connect to %s, writing the processes to stderr instead: %v\n", where, err)
+	return &syslogSink{}, nil
+}
+
+// syslogTagFor is the tag of the messages about the host labeled label,
+// which is empty when only one host is monitored.
+func syslogTagFor(label string) string {
+	if label == "" {
+		return syslogTag
+	}
+	// A colon would end the tag early, as in db1:3306
+	return syslogTag + "-" + fileLabel(label)
+}
+
+// parseSyslogAddr splits a -syslog-addr, [udp://|tcp://]host[:port], into
+// the network and address to dial. Empty is the local daemon.
+func parseSyslogAddr(addr string) (network, raddr string, err error) {
+	if addr == "" {
+		return "", "", nil
+	}
+	network, raddr = "udp", addr
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		network, raddr = scheme, rest
+	}
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("invalid -syslog-addr %q: the protocol must be udp or tcp", addr)
+	}
+	if _, _, err := net.SplitHostPort(raddr); err != nil {
+		raddr = net.JoinHostPort(strings.Trim(raddr, "[]"), "514")
+	}
+	return network, raddr, nil
+}
+
+// send writes p, captured on server, as one message tagged for label.
+func (s *syslogSink) send(label, server string, p catch.Process) {
+	line := syslogLine(server, p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dial == nil {
+		fmt.Fprintln(os.Stderr, line)
+		return
+	}
+	err := s.sendTagged(syslogTagFor(label), line)
+	if err != nil {
+		if !s.failing {
+			color.New(color.FgRed, color.Bold).Fprintf(os.Stderr,
+				"Warning: sending to syslog failed, writing the processes to stderr until it works again: %v\n", err)
+			s.failing = true
+		}
+		fmt.Fprintln(os.Stderr, line)
+		return
+	}
+	if s.failing {
+		fmt.Fprintln(os.Stderr, "Sending to syslog again")
+		s.failing = false
+	}
+}
+
+// sendTagged writes line with tag, connecting for it the first time.
+func (s *syslogSink) sendTagged(tag, line string) error {
+	writer, ok := s.writers[tag]
+	if !ok {
+		var err error
+		if writer, err = s.dial(tag); err != nil {
+			return err
+		}
+		s.writers[tag] = writer
+	}
+	return writer.Info(line)
+}
+
+// Close closes the syslog connections.
+func (s *syslogSink) Close() error {
+	var first error
+	for _, writer := range s.writers {
+		if err := writer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// syslogLine renders p as key=value pairs on one line, quoting values with
+// spaces or newlines and leaving out NULL columns.
+func syslogLine(server string, p catch.Process) string {
+	fields := []string{
+		"server=" + syslogValue(server),
+		"id=" + strconv.FormatInt(p.ID, 10),
+		"user=" + syslogValue(p.User),
+		"client_host=" + syslogValue(p.Host),
+	}
+	if p.DB.Valid {
+		fields = append(fields, "db="+syslogValue(p.DB.String))
+	}
+	fields = append(fields, "command="+syslogValue(p.Command), "time="+strconv.Itoa(p.Time))
+	if p.TimeMS.Valid {
+		fields = append(fields, "time_ms="+strconv.FormatInt(p.TimeMS.Int64, 10))
+	}
+	if p.State.Valid {
+		fields = append(fields, "state="+syslogValue(p.State.String))
+	}
+	if p.Info.Valid {
+		fields = append(fields, "info="+syslogValue(p.Info.String))
+	}
+	return strings.Join(fields, " ")
+}
+
+// syslogValue quotes value when it would otherwise not read back as one.
+func syslogValue(value string) string {
+	if value == "" || strings.ContainsFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r == '\\' || r > '~'
+	}) {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// dialSyslog fails, log/syslog isn't available on this platform.
+func dialSyslog(network, raddr, tag string) (syslogWriter, error) {
+	return nil, fmt.Errorf("syslog is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// fakeSyslog records the messages sent with each tag.
+type fakeSyslog struct {
+	tag      string
+	messages map[string][]string
+}
+
+func (f *fakeSyslog) Info(message string) error {
+	f.messages[f.tag] = append(f.messages[f.tag], message)
+	return nil
+}
+
+func (f *fakeSyslog) Close() error { return nil }
+
+func TestSyslogTagsEachHost(t *testing.T) {
+	messages := map[string][]string{}
+	dials := 0
+	sink := &syslogSink{
+		dial: func(tag string) (syslogWriter, error) {
+			dials++
+			return &fakeSyslog{tag: tag, messages: messages}, nil
+		},
+		writers: map[string]syslogWriter{},
+	}
+	p := catch.Process{ID: 4711, User: "app", Host: "10.0.0.5:51234", Command: "Query", Time: 3,
+		Info: sql.NullString{String: "SELECT 1", Valid: true}}
+
+	sink.send("", "db1:3306", p)
+	sink.send("db1:3306", "db1:3306", p)
+	sink.send("db2", "db2", p)
+	sink.send("db2", "db2", p)
+
+	want := map[string]int{"go-catch": 1, "go-catch-db1_3306": 1, "go-catch-db2": 2}
+	for tag, n := range want {
+		if len(messages[tag]) != n {
+			t.Errorf("tag %s got %d messages, want %d", tag, len(messages[tag]), n)
+		}
+	}
+	if len(messages) != len(want) || dials != len(want) {
+		t.Errorf("got tags %v after %d dials, want %v once each", messages, dials, want)
+	}
+	if got, line := messages["go-catch-db2"][0], "server=db2 id=4711 user=app client_host=10.0.0.5:51234 command=Query time=3 info=\"SELECT 1\""; got != line {
+		t.Errorf("got message %q, want %q", got, line)
+	}
+}
+
+func TestSyslogFallsBackToStderr(t *testing.T) {
+	sink := &syslogSink{
+		dial:    func(tag string) (syslogWriter, error) { return nil, errors.New("refused") },
+		writers: map[string]syslogWriter{},
+	}
+	sink.send("db1", "db1", catch.Process{ID: 1})
+	if !sink.failing {
+		t.Error("a failed dial isn't reported as failing")
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestParseSyslogAddr(t *testing.T) {
+	tests := []struct {
+		addr           string
+		network, raddr string
+		err            bool
+	}{
+		{"", "", "", false},
+		{"logs.example.com", "udp", "logs.example.com:514", false},
+		{"logs.example.com:1514", "udp", "logs.example.com:1514", false},
+		{"tcp://logs.example.com:6514", "tcp", "logs.example.com:6514", false},
+		{"udp://[2001:db8::1]", "udp", "[2001:db8::1]:514", false},
+		{"http://logs.example.com", "", "", true},
+	}
+	for _, tt := range tests {
+		network, raddr, err := parseSyslogAddr(tt.addr)
+		if (err != nil) != tt.err || network != tt.network || raddr != tt.raddr {
+			t.Errorf("parseSyslogAddr(%q) = %q, %q, %v", tt.addr, network, raddr, err)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows && !plan9
+
+package main
+
+import "log/syslog"
+
+// dialSyslog connects to the syslog daemon at raddr, or the local one when
+// network is empty, for messages tagged tag.
+func dialSyslog(network, raddr, tag string) (syslogWriter, error) {
+	return syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+}
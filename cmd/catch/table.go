@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"golang.org/x/term"
+)
+
+// defaultTableWidth is used when stdout isn't a terminal.
+const defaultTableWidth = 120
+
+// terminalWidth returns the width of the terminal on stdout.
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		return defaultTableWidth
+	}
+	return width
+}
+
+// truncate shortens s to at most width runes, ending it with an ellipsis
+// when something was cut.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	if width <= 1 {
+		return string(runes[:max(width, 0)])
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// formatProcessTable renders processes as one aligned row each, with INFO
+// collapsed onto one line and cut to fit width. server, when set, names the
+// monitored server.
+func formatProcessTable(processes []catch.Process, server string, width int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*************************** Processlist @ %s ***************************\n",
+		time.Now().Format("2006-01-02 15:04:05"))
+	if server != "" {
+		fmt.Fprintf(&b, "   SERVER: %s\n", server)
+	}
+
+	// Align every column but INFO, which is colored and cut to the width
+	// left after the others
+	var cells strings.Builder
+	w := tabwriter.NewWriter(&cells, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tHOST\tDB\tTIME\tSTATE\t")
+	for _, p := range processes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t\n", p.ID, p.User, p.Host, p.DB.String, p.FormatTime(), p.State.String)
+	}
+	w.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(cells.String(), "\n"), "\n")
+	b.WriteString(lines[0] + "INFO\n")
+	for i, p := range processes {
+		line := lines[i+1]
+		info := truncate(strings.Join(strings.Fields(p.Info.String), " "), width-len([]rune(line)))
+		_, infoColor := catch.ProcessColors(p)
+		b.WriteString(line + infoColor.Sprint(info) + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+	"github.com/fatih/color"
+)
+
+func TestTruncateKeepsRunes(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"SELECT 1", 20, "SELECT 1"},
+		{"SELECT 1", 8, "SELECT 1"},
+		{"SELECT 1", 5, "SELE…"},
+		{"SELECT '😀😀😀'", 10, "SELECT '😀…"},
+		{"SELECT '東京都'", 12, "SELECT '東京都'"},
+		{"SELECT '東京都'", 10, "SELECT '東…"},
+		{"😀😀", 1, "😀"},
+		{"😀😀", 0, ""},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.width)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) split a rune: %q", tt.s, tt.width, got)
+		}
+	}
+}
+
+func TestProcessTableCutsInfoOnRunes(t *testing.T) {
+	saved := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = saved })
+
+	p := catch.Process{
+		ID:      7,
+		User:    "app",
+		Host:    "10.0.0.1:5000",
+		Command: "Query",
+		Info:    sql.NullString{String: "SELECT * FROM reviews WHERE body = '最高😀😀😀 東京'", Valid: true},
+	}
+	for width := 50; width <= 100; width++ {
+		out := formatProcessTable([]catch.Process{p}, "", width)
+		if !utf8.ValidString(out) {
+			t.Fatalf("width %d: table holds invalid UTF-8: %q", width, out)
+		}
+		lines := strings.Split(out, "\n")
+		row := lines[2]
+		if n := utf8.RuneCountInString(row); n > width {
+			t.Errorf("width %d: row is %d runes wide: %q", width, n, row)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSL modes, as accepted by the mysql client's --ssl-mode
+const (
+	sslDisabled       = "DISABLED"
+	sslPreferred      = "PREFERRED"
+	sslRequired       = "REQUIRED"
+	sslVerifyCA       = "VERIFY_CA"
+	sslVerifyIdentity = "VERIFY_IDENTITY"
+)
+
+var sslModes = []string{sslDisabled, sslPreferred, sslRequired, sslVerifyCA, sslVerifyIdentity}
+
+// tlsConfigName is the name the custom TLS config is registered under
+const tlsConfigName = "catch"
+
+// sslOptions are the resolved --ssl-* settings.
+type sslOptions struct {
+	Mode string
+	CA   string
+	Cert string
+	Key  string
+}
+
+// configureTLS sets up cfg for the requested SSL mode. serverName is checked
+// against the server certificate in VERIFY_IDENTITY mode.
+func configureTLS(cfg *mysql.Config, ssl sslOptions, serverName string) error {
+	mode := strings.ToUpper(ssl.Mode)
+	if mode == "" {
+		// Like the mysql client, a CA without a mode means VERIFY_CA
+		if ssl.CA == "" {
+			return nil
+		}
+		mode = sslVerifyCA
+	}
+
+	switch mode {
+	case sslDisabled:
+		cfg.TLSConfig = "false"
+		return nil
+	case sslPreferred:
+		// TLS without certificate checks, falling back to plaintext when
+		// the server doesn't support it
+		cfg.TLSConfig = "preferred"
+		return nil
+	case sslRequired, sslVerifyCA, sslVerifyIdentity:
+	default:
+		return fmt.Errorf("invalid -ssl-mode %q (valid: %s)", ssl.Mode, strings.Join(sslModes, ", "))
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if ssl.CA != "" {
+		pem, err := os.ReadFile(ssl.CA)
+		if err != nil {
+			return fmt.Errorf("reading ssl-ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("ssl-ca %s contains no PEM certificates", ssl.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if ssl.Cert != "" || ssl.Key != "" {
+		if ssl.Cert == "" || ssl.Key == "" {
+			return errors.New("ssl-cert and ssl-key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(ssl.Cert, ssl.Key)
+		if err != nil {
+			return fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case sslRequired:
+		// Encrypted, but the server certificate isn't checked
+		tlsConfig.InsecureSkipVerify = true
+	case sslVerifyCA:
+		// Check the chain against the CA but not the host name
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyPeerCertificate = verifyChain(tlsConfig.RootCAs)
+	case sslVerifyIdentity:
+		tlsConfig.ServerName = serverName
+	}
+
+	if err := mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+		return err
+	}
+	cfg.TLSConfig = tlsConfigName
+	return nil
+}
+
+// connectionTransport describes how the session is encrypted, e.g.
+// "TLS TLS_AES_256_GCM_SHA384" or "unencrypted", so PREFERRED mode shows
+// what was actually negotiated.
+func connectionTransport(ctx context.Context, db *sql.DB) string {
+	var name, cipher string
+	err := db.QueryRowContext(ctx, "SHOW SESSION STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher)
+	switch {
+	case err != nil:
+		return "transport unknown"
+	case cipher == "":
+		return "unencrypted"
+	default:
+		return "TLS " + cipher
+	}
+}
+
+// verifyChain verifies the server certificate chain against roots (the
+// system pool when nil) without checking the host name.
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("server sent no certificate")
+		}
+
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range certs[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+		})
+		return err
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%FT%TZ)"
+//
+// Values left empty are filled in from the module and VCS information Go
+// embeds in the binary.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// buildVersion returns the version, commit and build date of the binary,
+// "unknown" for whatever can't be found.
+func buildVersion() (ver, rev, built string) {
+	ver, rev, built = version, commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if ver == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			ver = info.Main.Version
+		}
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if rev == "" {
+					rev = setting.Value[:min(len(setting.Value), 12)]
+				}
+			case "vcs.time":
+				if built == "" {
+					built = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		// Only the embedded revision can be out of date with the source
+		if modified && commit == "" && rev != "" {
+			rev += "-dirty"
+		}
+	}
+	if ver == "" {
+		ver = "dev"
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return ver, rev, built
+}
+
+// versionString describes the binary on one line, as printed by -version
+// and recorded in capture files.
+func versionString() string {
+	ver, rev, built := buildVersion()
+	return fmt.Sprintf("go-catch %s (commit %s, built %s, %s)", ver, rev, built, runtime.Version())
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChaosHour/go-catch/pkg/catch"
+)
+
+// webhookTimeout bounds one webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// slackTextLimit is the longest text Slack accepts in a section block,
+// less room for the code fence
+const slackTextLimit = 2900
+
+// alert is a process that has been running longer than -alert-time.
+type alert struct {
+	process catch.Process
+	host    string
+	at      time.Time
+}
+
+// alertRecord is the JSON document posted to -webhook.
+type alertRecord struct {
+	CapturedAt    string        `json:"captured_at"`
+	Event         string        `json:"event"`
+	MonitoredHost string        `json:"monitored_host"`
+	AlertTime     int           `json:"alert_time"`
+	Process       catch.Process `json:"process"`
+}
+
+// slackMessage is an incoming webhook message: text is the notification
+// fallback, blocks what the channel shows.
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// alerter posts alerts to the -webhook and -slack-webhook URLs. Deliveries
+// run in the background, so a slow or failing endpoint never holds up a
+// poll.
+type alerter struct {
+	webhook      string
+	slackWebhook string
+	threshold    int
+	client       *http.Client
+	wg           sync.WaitGroup
+}
+
+func newAlerter(webhook, slackWebhook string, threshold int) (*alerter, error) {
+	for _, target := range []struct{ flag, url string }{{"-webhook", webhook}, {"-slack-webhook", slackWebhook}} {
+		if target.url == "" {
+			continue
+		}
+		u, err := url.Parse(target.url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s %q, expected an http:// or https:// URL", target.flag, target.url)
+		}
+	}
+	return &alerter{
+		webhook:      webhook,
+		slackWebhook: slackWebhook,
+		threshold:    threshold,
+		client:       &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+// send delivers al to each webhook in the background, warning on stderr
+// with prefix when it fails.
+func (a *alerter) send(al alert, prefix string) {
+	if a.webhook != "" {
+		a.deliver(a.webhook, alertRecord{
+			CapturedAt:    al.at.Format(jsonTimeFormat),
+			Event:         "ALERT",
+			MonitoredHost: al.host,
+			AlertTime:     a.threshold,
+			Process:       al.process,
+		}, al, prefix)
+	}
+	if a.slackWebhook != "" {
+		a.deliver(a.slackWebhook, formatSlackAlert(al), al, prefix)
+	}
+}
+
+// deliver posts message, the JSON document for al, to webhook.
+func (a *alerter) deliver(webhook string, message interface{}, al alert, prefix string) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sWarning: cannot encode the alert for process %d: %v\n", prefix, al.process.ID, err)
+		return
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.post(webhook, body); err != nil {
+			fmt.Fprintf(os.Stderr, "%sWarning: alert webhook for process %d failed: %v\n", prefix, al.process.ID, err)
+		}
+	}()
+}
+
+// post sends body as JSON to webhook, failing on any status but 2xx.
+func (a *alerter) post(webhook string, body []byte) error {
+	resp, err := a.client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The error repeats the URL, secret included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return fmt.Errorf("%s: %w", redactURL(webhook), urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", redactURL(webhook), resp.Status)
+	}
+	return nil
+}
+
+// formatSlackAlert lays al out as Slack blocks: a header naming the
+// server, the process details as fields and the statement in a code block.
+func formatSlackAlert(al alert) slackMessage {
+	p := al.process
+	running := p.FormatTime()
+	if !p.TimeMS.Valid {
+		running += "s"
+	}
+	title := fmt.Sprintf("Query running for %s on %s", running, al.host)
+	// Headers are limited to 150 characters
+	if len(title) > 150 {
+		title = strings.ToValidUTF8(title[:149], "") + "…"
+	}
+	field := func(name, value string) slackText {
+		if value == "" {
+			value = "-"
+		}
+		return slackText{Type: "mrkdwn", Text: "*" + name + "*\n" + slackEscape(value)}
+	}
+
+	statement := strings.TrimSpace(p.Info.String)
+	if len(statement) > slackTextLimit {
+		statement = strings.ToValidUTF8(statement[:slackTextLimit], "") + "…"
+	}
+	// A fence inside the statement would end the code block early
+	statement = strings.ReplaceAll(statement, "```", "`\u200b``")
+
+	return slackMessage{
+		Text: title,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: title}},
+			{Type: "section", Fields: []slackText{
+				field("User", p.User),
+				field("Time", running),
+				field("Process ID", strconv.FormatInt(p.ID, 10)),
+				field("Client", p.Host),
+				field("Database", p.DB.String),
+				field("State", p.State.String),
+			}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "```" + slackEscape(statement) + "```"}},
+		},
+	}
+}
+
+// slackEscape escapes the characters Slack reads as markup in mrkdwn text.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// wait blocks until the alerts sent so far are delivered or have failed.
+func (a *alerter) wait() {
+	a.wg.Wait()
+}
+
+// redactURL masks the path and query of u in messages and -print-config,
+// since webhook URLs usually carry their secret there.
+func redactURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "the webhook"
+	}
+	redacted := parsed.Scheme + "://" + parsed.Host
+	if strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		redacted += "/*****"
+	}
+	return redacted
+}
@@ -0,0 +1,87 @@
+// Package catch reads the processlist and InnoDB lock waits of MySQL
+// servers, and the sessions of ProxySQL admin interfaces. It is the library
+// behind the go-catch command.
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Client reads the processlist of one MySQL server.
+type Client struct {
+	db *sql.DB
+
+	mu sync.Mutex
+	// server is detected on the first call that needs it
+	server *ServerInfo
+}
+
+// NewClient opens a client for the server named by a go-sql-driver DSN,
+// e.g. "monitor:secret@tcp(db1:3306)/". It doesn't connect until the first
+// call; the DSN's user needs the PROCESS privilege to see other sessions.
+func NewClient(dsn string) (*Client, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %w", err)
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{db: sql.OpenDB(connector)}, nil
+}
+
+// Server returns the flavor and version of the server, detected once.
+func (c *Client) Server(ctx context.Context) (ServerInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.server == nil {
+		info, err := DetectServer(ctx, c.db)
+		if err != nil {
+			return ServerInfo{}, err
+		}
+		c.server = &info
+	}
+	return *c.server, nil
+}
+
+// ProcessList returns the server's active processes, longest running first,
+// with the columns its flavor and version offer.
+func (c *Client) ProcessList(ctx context.Context) ([]Process, error) {
+	server, err := c.Server(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ProcessListFor(ctx, c.db, server)
+}
+
+// LockWaits returns the InnoDB lock waits on the server, longest wait first.
+func (c *Client) LockWaits(ctx context.Context) ([]LockWait, error) {
+	server, err := c.Server(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return LockWaits(ctx, c.db, server)
+}
+
+// ReplicationStatus returns the state of each replication channel, none
+// when the server isn't a replica.
+func (c *Client) ReplicationStatus(ctx context.Context) ([]ReplicaStatus, error) {
+	return ReplicationStatus(ctx, c.db)
+}
+
+// Explain returns the EXPLAIN plan of the SELECT p is running.
+func (c *Client) Explain(ctx context.Context, p Process) (Plan, error) {
+	return Explain(ctx, c.db, p)
+}
+
+// Close closes the client's connections.
+func (c *Client) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,116 @@
+package catch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// valueLists matches the list of placeholders Fingerprint leaves of an IN
+// list or a multi-row VALUES, whatever its length
+var valueLists = regexp.MustCompile(`\(\?(?:, \?)+\)`)
+
+// Fingerprint normalizes a statement the way pt-query-digest does, so that
+// executions with different values compare equal: comments are dropped,
+// strings and numbers become ?, lists of them (?+), and everything but
+// quoted identifiers is lowercased. Tokens are separated by one space,
+// whatever the original spacing, except around ( ) , . ; and @.
+func Fingerprint(query string) string {
+	var b strings.Builder
+	var last byte
+	token := func(s string) {
+		if last != 0 && !strings.ContainsRune(",).;", rune(s[0])) && !strings.ContainsRune("(.@", rune(last)) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s)
+		last = s[len(s)-1]
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+				break
+			}
+			i += end + 4
+		case c == '#' || strings.HasPrefix(query[i:], "-- "):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+				break
+			}
+			i += end
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i)
+			token("?")
+		case c == '`':
+			end := skipQuoted(query, i)
+			token(query[i:end])
+			i = end
+		case isDigit(c):
+			// Digits inside a word, as in t1, are read with the word
+			for i < len(query) && (isWordByte(query[i]) || query[i] == '.') {
+				i++
+			}
+			token("?")
+		case isWordByte(c):
+			start := i
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+			token(strings.ToLower(query[start:i]))
+		case strings.ContainsRune("<>=!|&", rune(c)):
+			// Operators such as >= and != are one token
+			start := i
+			for i < len(query) && strings.ContainsRune("<>=!|&", rune(query[i])) {
+				i++
+			}
+			token(query[start:i])
+		default:
+			token(query[i : i+1])
+			i++
+		}
+	}
+	return valueLists.ReplaceAllString(b.String(), "(?+)")
+}
+
+// Digest identifies the statements that share a Fingerprint: the first 16
+// bytes of its SHA-256, in hex.
+func Digest(query string) string {
+	sum := sha256.Sum256([]byte(Fingerprint(query)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// skipQuoted returns the index after the string or identifier quoted by
+// query[start], which may escape its quote by doubling it or, for strings,
+// with a backslash.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
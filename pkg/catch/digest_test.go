@@ -0,0 +1,56 @@
+package catch
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM orders WHERE id = 5", "select * from orders where id = ?"},
+		{"select  *\n\tfrom ORDERS\nwhere ID=5", "select * from orders where id = ?"},
+		{"SELECT name FROM users WHERE name = 'O''Brien'", "select name from users where name = ?"},
+		{`SELECT name FROM users WHERE name = "it\"s"`, "select name from users where name = ?"},
+		{"SELECT * FROM t WHERE id IN (1, 2, 3)", "select * from t where id in (?+)"},
+		{"SELECT * FROM t WHERE id IN (1)", "select * from t where id in (?)"},
+		{"INSERT INTO t (a, b) VALUES (1, 'x')", "insert into t (a, b) values (?+)"},
+		{"SELECT * FROM t1 WHERE price > 1.5", "select * from t1 where price > ?"},
+		{"SELECT a FROM t WHERE b >= 1 AND c != 2", "select a from t where b >= ? and c != ?"},
+		{"/* app:checkout */ SELECT 1", "select ?"},
+		{"SELECT 1 -- trailing\n", "select ?"},
+		{"SELECT 1 # trailing", "select ?"},
+		{"SELECT `Order`.`ID` FROM `Order`", "select `Order`.`ID` from `Order`"},
+		{"SELECT @@version", "select @@version"},
+		{"SET @a = 1;", "set @a = ?;"},
+		{"SELECT * FROM café WHERE name = '東京'", "select * from café where name = ?"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	same := []string{
+		"SELECT * FROM orders WHERE id = 5",
+		"select * from orders where id = 42",
+		"/* retry */ SELECT *\n  FROM orders\n WHERE id = 7",
+	}
+	want := Digest(same[0])
+	if len(want) != 32 {
+		t.Errorf("Digest is %q, want 32 hex digits", want)
+	}
+	for _, query := range same[1:] {
+		if got := Digest(query); got != want {
+			t.Errorf("Digest(%q) = %s, want %s as for %q", query, got, want, same[0])
+		}
+	}
+	if Digest("SELECT * FROM customers WHERE id = 5") == want {
+		t.Error("statements on different tables share a digest")
+	}
+	if Digest("SELECT * FROM t WHERE id IN (1, 2)") != Digest("SELECT * FROM t WHERE id IN (1, 2, 3, 4)") {
+		t.Error("IN lists of different lengths have different digests")
+	}
+}
@@ -0,0 +1,98 @@
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrNotExplainable is returned by Explain for statements other than
+// SELECTs, which it leaves alone.
+var ErrNotExplainable = errors.New("only SELECT statements are explained")
+
+// Plan is the EXPLAIN output of a statement: the columns the server
+// returned and one row per table access, NULL where a column is empty.
+type Plan struct {
+	Columns []string
+	Rows    [][]sql.NullString
+}
+
+// Explain runs EXPLAIN on the SELECT p is running, in p's default database,
+// on a connection of db. EXPLAIN doesn't run the statement itself, though
+// before MySQL 5.7 derived tables are still materialized. Statements the
+// processlist cut short fail to parse and return the server's error.
+func Explain(ctx context.Context, db *sql.DB, p Process) (Plan, error) {
+	statement := strings.TrimRight(strings.TrimSpace(p.Info.String), "; \t\r\n")
+	if ClassifyQuery(statement) != QuerySelect {
+		return Plan{}, ErrNotExplainable
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+	defer conn.Close()
+	if p.DB.Valid && p.DB.String != "" {
+		if _, err := conn.ExecContext(ctx, "USE `"+strings.ReplaceAll(p.DB.String, "`", "``")+"`"); err != nil {
+			return Plan{}, err
+		}
+		// Keep the changed default database out of the pool
+		defer conn.Raw(func(any) error { return driver.ErrBadConn })
+	}
+
+	rows, err := conn.QueryContext(ctx, "EXPLAIN "+statement)
+	if err != nil {
+		return Plan{}, err
+	}
+	defer rows.Close()
+
+	var plan Plan
+	if plan.Columns, err = rows.Columns(); err != nil {
+		return Plan{}, err
+	}
+	for rows.Next() {
+		values := make([]sql.NullString, len(plan.Columns))
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return Plan{}, err
+		}
+		plan.Rows = append(plan.Rows, values)
+	}
+	return plan, rows.Err()
+}
+
+// FormatPlan renders the plan of the statement process id is running as a
+// text block with an aligned table. server, when set, names the server.
+func FormatPlan(id int64, statement string, plan Plan, server string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*************************** Explain @ %s ***************************\n",
+		time.Now().Format("2006-01-02 15:04:05"))
+	if server != "" {
+		fmt.Fprintf(&b, "   SERVER: %s\n", server)
+	}
+	fmt.Fprintf(&b, "       ID: %d\n    QUERY: %s\n", id, statement)
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(plan.Columns, "\t")+"\t")
+	for _, row := range plan.Rows {
+		for _, value := range row {
+			if value.Valid {
+				fmt.Fprint(w, value.String, "\t")
+			} else {
+				fmt.Fprint(w, "NULL\t")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package catch
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// FormatProcess renders p as a text block, like the mysql client's \G
+// output. server, when set, names the server the process was seen on, and
+// useColor colors STATE and INFO as ProcessColors picks.
+func FormatProcess(p Process, server string, useColor bool) string {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+
+	state, query := p.State.String, p.Info.String
+	if useColor {
+		stateColor, infoColor := ProcessColors(p)
+		state, query = stateColor.Sprint(state), infoColor.Sprint(query)
+	}
+
+	header := fmt.Sprintf("*************************** Process Info @ %s ***************************\n", timestamp)
+	if server != "" {
+		header += fmt.Sprintf("   SERVER: %s\n", server)
+	}
+	// Only sessions read from ProxySQL have a hostgroup
+	hostgroup := ""
+	if p.Hostgroup.Valid {
+		hostgroup = fmt.Sprintf("HOSTGROUP: %d\n", p.Hostgroup.Int64)
+	}
+	// MariaDB and Percona Server count the rows examined
+	examined := ""
+	if p.RowsExamined.Valid {
+		examined = fmt.Sprintf(" EXAMINED: %d\n", p.RowsExamined.Int64)
+	}
+	info := fmt.Sprintf("       ID: %d\n"+
+		"     USER: %s\n"+
+		"     HOST: %s\n"+
+		"       DB: %s\n"+
+		"%s"+
+		"  COMMAND: %s\n"+
+		"     TIME: %s\n"+
+		"%s"+
+		"    STATE: %s\n"+
+		"     INFO: %s\n\n",
+		p.ID, p.User, p.Host, p.DB.String, hostgroup, p.Command, p.FormatTime(), examined, state, query)
+
+	return header + info
+}
+
+// FormatLockWait renders w as a text block naming the blocked and the
+// blocking process with their statements. server, when set, names the
+// server, and useColor highlights the blocker.
+func FormatLockWait(w LockWait, server string, useColor bool) string {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+
+	blocking := fmt.Sprintf("%d, transaction open %ds", w.BlockingID, w.BlockingTime)
+	blockingQuery := w.BlockingQuery.String
+	if !w.BlockingQuery.Valid {
+		blockingQuery = "NULL (idle in an open transaction)"
+	}
+	if useColor {
+		blocking = color.New(color.FgRed, color.Bold).Sprint(blocking)
+		blockingQuery = color.New(color.FgRed).Sprint(blockingQuery)
+	}
+	lock := fmt.Sprintf("%s on %s", w.LockMode, w.Table)
+	if w.Index.Valid {
+		lock += fmt.Sprintf(" (index %s)", w.Index.String)
+	}
+
+	header := fmt.Sprintf("*************************** Lock Wait @ %s ***************************\n", timestamp)
+	if server != "" {
+		header += fmt.Sprintf("   SERVER: %s\n", server)
+	}
+	return header + fmt.Sprintf("  WAITING: %d, waiting %ds\n"+
+		"    QUERY: %s\n"+
+		" BLOCKING: %s\n"+
+		"    QUERY: %s\n"+
+		"     LOCK: %s\n\n",
+		w.WaitingID, w.WaitTime, w.WaitingQuery.String, blocking, blockingQuery, lock)
+}
+
+// ProcessColors picks the STATE and INFO colors for p, by state and then
+// by statement type. A state waiting on a lock is always bold red.
+func ProcessColors(p Process) (stateColor, infoColor *color.Color) {
+	stateColor = color.New(color.FgYellow)
+	infoColor = color.New(color.FgCyan)
+	switch {
+	case p.State.String == "login":
+		stateColor = color.New(color.FgRed)
+	case p.State.String == "Receiving from client":
+		stateColor = color.New(color.FgBlue)
+	default:
+		lower := strings.ToLower(p.Info.String)
+		switch ClassifyQuery(p.Info.String) {
+		case QuerySelect:
+			if strings.Contains(lower, "count(*)") {
+				infoColor = color.New(color.FgMagenta, color.Bold)
+			} else if strings.Contains(lower, "limit") {
+				infoColor = color.New(color.FgGreen, color.Bold)
+			} else {
+				infoColor = color.New(color.FgCyan, color.Bold)
+			}
+			stateColor = color.New(color.FgGreen)
+		case QueryInsert:
+			infoColor = color.New(color.FgGreen, color.Bold)
+		case QueryUpdate:
+			infoColor = color.New(color.FgYellow, color.Bold)
+		case QueryDelete:
+			infoColor = color.New(color.FgRed, color.Bold)
+		case QueryDDL:
+			infoColor = color.New(color.FgMagenta, color.Bold)
+		}
+	}
+	if IsBlockedState(p.State.String) {
+		stateColor = color.New(color.FgRed, color.Bold)
+	}
+	return stateColor, infoColor
+}
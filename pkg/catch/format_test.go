@@ -0,0 +1,113 @@
+package catch
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestFormatProcess(t *testing.T) {
+	p := Process{
+		ID:      7,
+		User:    "app",
+		Host:    "10.0.0.1:5000",
+		DB:      sql.NullString{String: "shop", Valid: true},
+		Command: "Query",
+		Time:    3,
+		State:   sql.NullString{String: "executing", Valid: true},
+		Info:    sql.NullString{String: "SELECT * FROM reviews WHERE body = '最高😀'", Valid: true},
+	}
+	out := FormatProcess(p, "", false)
+	if !strings.HasPrefix(out, "*************************** Process Info @ ") {
+		t.Errorf("got %q, want a Process Info header first", out)
+	}
+	want := "       ID: 7\n" +
+		"     USER: app\n" +
+		"     HOST: 10.0.0.1:5000\n" +
+		"       DB: shop\n" +
+		"  COMMAND: Query\n" +
+		"     TIME: 3\n" +
+		"    STATE: executing\n" +
+		"     INFO: SELECT * FROM reviews WHERE body = '最高😀'\n\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("got %q, want it to end with %q", out, want)
+	}
+	if strings.Contains(out, "SERVER:") || strings.Contains(out, "HOSTGROUP:") || strings.Contains(out, "EXAMINED:") {
+		t.Errorf("got %q, want no lines for unset columns", out)
+	}
+
+	p.Hostgroup = sql.NullInt64{Int64: 10, Valid: true}
+	p.RowsExamined = sql.NullInt64{Int64: 1500, Valid: true}
+	p.TimeMS = sql.NullInt64{Int64: 3210, Valid: true}
+	out = FormatProcess(p, "db1", false)
+	for _, line := range []string{"   SERVER: db1\n", "HOSTGROUP: 10\n", " EXAMINED: 1500\n", "     TIME: 3.210s\n"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("got %q, want a %q line", out, line)
+		}
+	}
+}
+
+func TestFormatLockWait(t *testing.T) {
+	w := LockWait{
+		WaitingID:    12,
+		WaitingQuery: sql.NullString{String: "UPDATE orders SET paid = 1 WHERE id = 5", Valid: true},
+		WaitTime:     8,
+		BlockingID:   9,
+		BlockingTime: 120,
+		Table:        "`shop`.`orders`",
+		Index:        sql.NullString{String: "PRIMARY", Valid: true},
+		LockMode:     "X",
+	}
+	out := FormatLockWait(w, "db1", false)
+	for _, line := range []string{
+		"   SERVER: db1\n",
+		"  WAITING: 12, waiting 8s\n",
+		"    QUERY: UPDATE orders SET paid = 1 WHERE id = 5\n",
+		" BLOCKING: 9, transaction open 120s\n",
+		"    QUERY: NULL (idle in an open transaction)\n",
+		"     LOCK: X on `shop`.`orders` (index PRIMARY)\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("got %q, want a %q line", out, line)
+		}
+	}
+}
+
+func TestFormatPlan(t *testing.T) {
+	plan := Plan{
+		Columns: []string{"id", "table", "key"},
+		Rows: [][]sql.NullString{
+			{{String: "1", Valid: true}, {String: "orders", Valid: true}, {}},
+		},
+	}
+	out := FormatPlan(7, "SELECT * FROM orders", plan, "")
+	if !strings.Contains(out, "       ID: 7\n    QUERY: SELECT * FROM orders\n") {
+		t.Errorf("got %q, want the process and statement", out)
+	}
+	if !strings.Contains(out, "id  table   key   \n1   orders  NULL  \n") {
+		t.Errorf("got %q, want the plan as an aligned table with NULL", out)
+	}
+}
+
+func TestProcessColors(t *testing.T) {
+	tests := []struct {
+		state, info string
+		stateColor  *color.Color
+		infoColor   *color.Color
+	}{
+		{"executing", "SELECT COUNT(*) FROM orders", color.New(color.FgGreen), color.New(color.FgMagenta, color.Bold)},
+		{"executing", "select * from orders limit 5", color.New(color.FgGreen), color.New(color.FgGreen, color.Bold)},
+		{"updating", "UPDATE orders SET paid = 1", color.New(color.FgYellow), color.New(color.FgYellow, color.Bold)},
+		{"Waiting for table metadata lock", "ALTER TABLE orders ADD c INT", color.New(color.FgRed, color.Bold), color.New(color.FgMagenta, color.Bold)},
+		{"login", "", color.New(color.FgRed), color.New(color.FgCyan)},
+	}
+	for _, tt := range tests {
+		p := Process{State: sql.NullString{String: tt.state, Valid: true}, Info: sql.NullString{String: tt.info, Valid: true}}
+		stateColor, infoColor := ProcessColors(p)
+		if !stateColor.Equals(tt.stateColor) || !infoColor.Equals(tt.infoColor) {
+			t.Errorf("%q / %q: got other colors than expected", tt.state, tt.info)
+		}
+	}
+}
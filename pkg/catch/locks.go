@@ -0,0 +1,80 @@
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// LockWait is an InnoDB transaction waiting for a row lock another
+// transaction holds. The IDs are processlist IDs, as KILL takes them.
+type LockWait struct {
+	WaitingID    int64
+	WaitingQuery sql.NullString
+	// WaitTime is how many seconds the lock has been waited for
+	WaitTime int
+	// BlockingQuery is NULL when the blocker is idle in an open transaction
+	BlockingID    int64
+	BlockingQuery sql.NullString
+	// BlockingTime is how many seconds the blocking transaction has been open
+	BlockingTime int
+	// Table is the locked table as schema.table, Index the locked index
+	Table    string
+	Index    sql.NullString
+	LockMode string
+}
+
+// lockWaitsQuery joins each waiting transaction to the one blocking it,
+// longest wait first. MySQL 8.0 moved the lock tables to
+// performance_schema; older servers and MariaDB keep them in
+// information_schema.
+func lockWaitsQuery(server ServerInfo) string {
+	columns := `r.trx_mysql_thread_id, r.trx_query, TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW()),
+			 b.trx_mysql_thread_id, b.trx_query, TIMESTAMPDIFF(SECOND, b.trx_started, NOW())`
+	if server.Flavor != FlavorMariaDB && server.Major >= 8 {
+		return `SELECT ` + columns + `,
+			 CONCAT(l.OBJECT_SCHEMA, '.', l.OBJECT_NAME), l.INDEX_NAME, l.LOCK_MODE
+			 FROM performance_schema.data_lock_waits w
+			 JOIN information_schema.innodb_trx r ON r.trx_id = w.REQUESTING_ENGINE_TRANSACTION_ID
+			 JOIN information_schema.innodb_trx b ON b.trx_id = w.BLOCKING_ENGINE_TRANSACTION_ID
+			 JOIN performance_schema.data_locks l ON l.ENGINE_LOCK_ID = w.REQUESTING_ENGINE_LOCK_ID
+			 ORDER BY 3 DESC`
+	}
+	return `SELECT ` + columns + `,
+			 l.lock_table, l.lock_index, l.lock_mode
+			 FROM information_schema.innodb_lock_waits w
+			 JOIN information_schema.innodb_trx r ON r.trx_id = w.requesting_trx_id
+			 JOIN information_schema.innodb_trx b ON b.trx_id = w.blocking_trx_id
+			 JOIN information_schema.innodb_locks l ON l.lock_id = w.requested_lock_id
+			 ORDER BY 3 DESC`
+}
+
+// LockWaits lists the InnoDB lock waits on the server behind db, from the
+// lock tables server offers, longest wait first. It needs the PROCESS
+// privilege, and SELECT on performance_schema for MySQL 8.0.
+func LockWaits(ctx context.Context, db *sql.DB, server ServerInfo) ([]LockWait, error) {
+	rows, err := db.QueryContext(ctx, lockWaitsQuery(server))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var waits []LockWait
+	for rows.Next() {
+		var w LockWait
+		var waitTime, blockingTime sql.NullInt64
+		var table, mode sql.NullString
+		err := rows.Scan(&w.WaitingID, &w.WaitingQuery, &waitTime,
+			&w.BlockingID, &w.BlockingQuery, &blockingTime, &table, &w.Index, &mode)
+		if err != nil {
+			return nil, err
+		}
+		w.WaitTime = int(waitTime.Int64)
+		w.BlockingTime = int(blockingTime.Int64)
+		// information_schema quotes it as `schema`.`table`
+		w.Table = strings.ReplaceAll(table.String, "`", "")
+		w.LockMode = mode.String
+		waits = append(waits, w)
+	}
+	return waits, rows.Err()
+}
@@ -0,0 +1,193 @@
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Process is one row of the server's processlist. Its JSON encoding uses
+// the field names of the tags, with NULL columns as null.
+type Process struct {
+	ID      int64          `json:"id"`
+	User    string         `json:"user"`
+	Host    string         `json:"host"`
+	DB      sql.NullString `json:"db"`
+	Command string         `json:"command"`
+	Time    int            `json:"time"`
+	State   sql.NullString `json:"state"`
+	Info    sql.NullString `json:"info"`
+	// Hostgroup is the ProxySQL hostgroup serving the session
+	Hostgroup sql.NullInt64 `json:"hostgroup,omitempty"`
+	// RowsExamined counts the rows the statement examined so far, on
+	// servers that report it
+	RowsExamined sql.NullInt64 `json:"rows_examined,omitempty"`
+	// TimeMS is TIME in milliseconds, on servers with a TIME_MS column
+	TimeMS sql.NullInt64 `json:"time_ms,omitempty"`
+}
+
+// FormatTime renders how long p has been running: seconds with
+// milliseconds, such as 1.234s, when TimeMS is known, and the whole seconds
+// of Time otherwise.
+func (p Process) FormatTime() string {
+	if p.TimeMS.Valid {
+		return fmt.Sprintf("%d.%03ds", p.TimeMS.Int64/1000, p.TimeMS.Int64%1000)
+	}
+	return strconv.Itoa(p.Time)
+}
+
+// MarshalJSON encodes p with the names of its tags, writing NULL columns
+// as null and leaving out the NULL ones that only some servers have.
+func (p Process) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID           int64   `json:"id"`
+		User         string  `json:"user"`
+		Host         string  `json:"host"`
+		DB           *string `json:"db"`
+		Command      string  `json:"command"`
+		Time         int     `json:"time"`
+		State        *string `json:"state"`
+		Info         *string `json:"info"`
+		Hostgroup    *int64  `json:"hostgroup,omitempty"`
+		RowsExamined *int64  `json:"rows_examined,omitempty"`
+		TimeMS       *int64  `json:"time_ms,omitempty"`
+	}{
+		ID:           p.ID,
+		User:         p.User,
+		Host:         p.Host,
+		DB:           nullString(p.DB),
+		Command:      p.Command,
+		Time:         p.Time,
+		State:        nullString(p.State),
+		Info:         nullString(p.Info),
+		Hostgroup:    nullInt64(p.Hostgroup),
+		RowsExamined: nullInt64(p.RowsExamined),
+		TimeMS:       nullInt64(p.TimeMS),
+	})
+}
+
+func nullString(ns sql.NullString) *string {
+	if !ns.Valid {
+		return nil
+	}
+	return &ns.String
+}
+
+func nullInt64(ni sql.NullInt64) *int64 {
+	if !ni.Valid {
+		return nil
+	}
+	return &ni.Int64
+}
+
+// QueryOptions change which threads ProcessListWith reads.
+type QueryOptions struct {
+	// IncludeSleep also lists idle connections, which are skipped otherwise
+	IncludeSleep bool
+	// Where is an SQL condition on the processlist columns that rows must
+	// also meet, e.g. "USER LIKE 'app%'"
+	Where string
+	// ExcludeSelf leaves out the connection reading the processlist, by
+	// its CONNECTION_ID(), whatever it is running
+	ExcludeSelf bool
+}
+
+// processListQuery lists the threads doing something, longest running
+// first, from the processlist table of server. Sleeping connections are
+// skipped unless options include them. After the columns every server has
+// come the rows examined and TIME_MS, where server has them.
+func processListQuery(server ServerInfo, options QueryOptions) string {
+	columns := "ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO"
+	if column := server.rowsExaminedColumn(); column != "" {
+		columns += ", " + column
+	}
+	if server.HasTimeMS() {
+		columns += ", TIME_MS"
+	}
+	where := `command != 'Sleep'
+			 AND (COMMAND = 'Query' 
+				  OR INFO IS NOT NULL
+				  OR STATE NOT IN ('', 'init', 'after create', 'CONNECTING')
+				  OR TIME > 0)`
+	if options.IncludeSleep {
+		where = "TRUE"
+	}
+	if options.ExcludeSelf {
+		// Evaluated on the connection running the query, so it holds
+		// across reconnects and pool turnover
+		where += "\n\t\t\t AND ID != CONNECTION_ID()"
+	}
+	if options.Where != "" {
+		// Parenthesized, so an OR in it can't widen the conditions above
+		where += "\n\t\t\t AND (" + options.Where + ")"
+	}
+	return `SELECT ` + columns + `
+			 FROM ` + server.ProcessListSource() + `
+			 WHERE ` + where + `
+			 ORDER BY TIME DESC`
+}
+
+// ProcessList reads the processlist of the MySQL server behind db, longest
+// running first, with the columns every server version has.
+func ProcessList(ctx context.Context, db *sql.DB) ([]Process, error) {
+	return ProcessListFor(ctx, db, ServerInfo{})
+}
+
+// ProcessListFor reads the processlist like ProcessList, from the best
+// source server offers and with the extra columns it has, such as
+// RowsExamined and TimeMS on MariaDB and Percona Server. server comes from
+// DetectServer.
+func ProcessListFor(ctx context.Context, db *sql.DB, server ServerInfo) ([]Process, error) {
+	return ProcessListWith(ctx, db, server, QueryOptions{})
+}
+
+// ProcessListWith reads the processlist like ProcessListFor, limited or
+// widened by options.
+func ProcessListWith(ctx context.Context, db *sql.DB, server ServerInfo, options QueryOptions) ([]Process, error) {
+	rows, err := db.QueryContext(ctx, processListQuery(server, options))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var processes []Process
+	for rows.Next() {
+		var p Process
+		// MariaDB's TIME_MS is a decimal with microseconds
+		var timeMS sql.NullFloat64
+		dest := []interface{}{&p.ID, &p.User, &p.Host, &p.DB, &p.Command, &p.Time, &p.State, &p.Info}
+		if server.rowsExaminedColumn() != "" {
+			dest = append(dest, &p.RowsExamined)
+		}
+		if server.HasTimeMS() {
+			dest = append(dest, &timeMS)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if timeMS.Valid {
+			p.TimeMS = sql.NullInt64{Int64: int64(timeMS.Float64), Valid: true}
+		}
+		processes = append(processes, p)
+	}
+	return processes, rows.Err()
+}
+
+// IsBlockedState reports whether a processlist STATE means the statement is
+// waiting on another session, as in "Waiting for table metadata lock" or
+// the "Locked" of older servers.
+func IsBlockedState(state string) bool {
+	return strings.HasPrefix(state, "Waiting for") || state == "Locked"
+}
+
+// IsMonitoringQuery reports whether info is the query ProcessList or
+// ProxySQLProcessList runs, so callers can leave their own polling out.
+func IsMonitoringQuery(info string) bool {
+	// Check if this is our own monitoring query, whatever its QueryOptions
+	return strings.Contains(info, "_schema.processlist") &&
+		strings.Contains(info, "ORDER BY TIME DESC") ||
+		isProxySQLMonitoringQuery(info)
+}
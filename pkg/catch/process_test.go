@@ -0,0 +1,98 @@
+package catch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"testing"
+)
+
+func TestIsMonitoringQuery(t *testing.T) {
+	queries := map[string]string{
+		"information_schema":      processListQuery(ServerInfo{}, QueryOptions{}),
+		"performance_schema":      processListQuery(ServerInfo{Flavor: "mysql", Major: 8, Minor: 0, Patch: 36, PerformanceSchema: true}, QueryOptions{}),
+		"with options":            processListQuery(ServerInfo{}, QueryOptions{IncludeSleep: true, ExcludeSelf: true, Where: "USER = 'app'"}),
+		"MariaDB with extra cols": processListQuery(ServerInfo{Flavor: "mariadb", Major: 10, Minor: 11}, QueryOptions{}),
+		"ProxySQL":                proxySQLQuery,
+	}
+	for name, query := range queries {
+		if !IsMonitoringQuery(query) {
+			t.Errorf("%s: our query not recognized: %s", name, query)
+		}
+	}
+
+	for _, info := range []string{
+		"",
+		"SELECT * FROM orders ORDER BY TIME DESC",
+		"SELECT * FROM information_schema.processlist",
+		"SHOW FULL PROCESSLIST",
+	} {
+		if IsMonitoringQuery(info) {
+			t.Errorf("%q taken for our monitoring query", info)
+		}
+	}
+}
+
+func TestIsBlockedState(t *testing.T) {
+	for state, want := range map[string]bool{
+		"Waiting for table metadata lock": true,
+		"Waiting for table level lock":    true,
+		"Locked":                          true,
+		"Sending data":                    false,
+		"executing":                       false,
+		"":                                false,
+	} {
+		if got := IsBlockedState(state); got != want {
+			t.Errorf("IsBlockedState(%q) = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestProcessFormatTime(t *testing.T) {
+	tests := []struct {
+		p    Process
+		want string
+	}{
+		{Process{Time: 0}, "0"},
+		{Process{Time: 42}, "42"},
+		{Process{Time: 1, TimeMS: sql.NullInt64{Int64: 1234, Valid: true}}, "1.234s"},
+		{Process{TimeMS: sql.NullInt64{Int64: 5, Valid: true}}, "0.005s"},
+		{Process{Time: 61, TimeMS: sql.NullInt64{Int64: 61000, Valid: true}}, "61.000s"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.FormatTime(); got != tt.want {
+			t.Errorf("FormatTime of %+v = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestProcessMarshalJSON(t *testing.T) {
+	p := Process{
+		ID:      7,
+		User:    "app",
+		Host:    "10.0.0.1:5000",
+		Command: "Query",
+		Time:    3,
+		State:   sql.NullString{String: "executing", Valid: true},
+		Info:    sql.NullString{String: "SELECT '😀'", Valid: true},
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":7,"user":"app","host":"10.0.0.1:5000","db":null,"command":"Query","time":3,"state":"executing","info":"SELECT '😀'"}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	p.Hostgroup = sql.NullInt64{Int64: 10, Valid: true}
+	p.RowsExamined = sql.NullInt64{Int64: 0, Valid: true}
+	p.TimeMS = sql.NullInt64{Int64: 3210, Valid: true}
+	data, err = json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"id":7,"user":"app","host":"10.0.0.1:5000","db":null,"command":"Query","time":3,"state":"executing","info":"SELECT '😀'","hostgroup":10,"rows_examined":0,"time_ms":3210}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,60 @@
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// proxySQLQuery lists the client sessions ProxySQL is serving. Idle
+// sessions are skipped like Sleep threads are on MySQL. The admin session
+// running this query is not listed there, so it needs no exclusion.
+const proxySQLQuery = `SELECT SessionID, user, db, cli_host, cli_port, hostgroup, command, time_ms, info
+			 FROM stats_mysql_processlist
+			 WHERE command != 'Sleep'
+			 ORDER BY time_ms DESC`
+
+// isProxySQLMonitoringQuery matches proxySQLQuery, in case it shows up when
+// the admin interface is reached through another ProxySQL.
+func isProxySQLMonitoringQuery(info string) bool {
+	return strings.Contains(info, "FROM stats_mysql_processlist")
+}
+
+// ProxySQLProcessList reads stats_mysql_processlist from the ProxySQL
+// admin interface behind db, mapping its columns onto Process. time_ms is
+// kept in TimeMS and its whole seconds in Time, and the session's hostgroup
+// in Hostgroup.
+func ProxySQLProcessList(ctx context.Context, db *sql.DB) ([]Process, error) {
+	rows, err := db.QueryContext(ctx, proxySQLQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var processes []Process
+	for rows.Next() {
+		var (
+			p             Process
+			user, cliHost sql.NullString
+			cliPort       sql.NullInt64
+			command       sql.NullString
+			timeMS        sql.NullInt64
+		)
+		err := rows.Scan(&p.ID, &user, &p.DB, &cliHost, &cliPort, &p.Hostgroup, &command, &timeMS, &p.Info)
+		if err != nil {
+			return nil, err
+		}
+		p.User = user.String
+		p.Host = cliHost.String
+		if cliPort.Valid {
+			p.Host = net.JoinHostPort(cliHost.String, strconv.FormatInt(cliPort.Int64, 10))
+		}
+		p.Command = command.String
+		p.Time = int(timeMS.Int64 / 1000)
+		p.TimeMS = timeMS
+		processes = append(processes, p)
+	}
+	return processes, rows.Err()
+}
@@ -0,0 +1,96 @@
+package catch
+
+import "strings"
+
+// QueryType is the kind of statement in a processlist INFO value.
+type QueryType int
+
+const (
+	QueryOther QueryType = iota
+	QuerySelect
+	QueryInsert
+	QueryUpdate
+	QueryDelete
+	QueryDDL
+	QueryShow
+)
+
+func (t QueryType) String() string {
+	switch t {
+	case QuerySelect:
+		return "SELECT"
+	case QueryInsert:
+		return "INSERT"
+	case QueryUpdate:
+		return "UPDATE"
+	case QueryDelete:
+		return "DELETE"
+	case QueryDDL:
+		return "DDL"
+	case QueryShow:
+		return "SHOW"
+	default:
+		return "OTHER"
+	}
+}
+
+// IsQuery reports whether t is DML or DDL, the statements go-catch -q shows.
+func (t QueryType) IsQuery() bool {
+	switch t {
+	case QuerySelect, QueryInsert, QueryUpdate, QueryDelete, QueryDDL:
+		return true
+	default:
+		return false
+	}
+}
+
+// ClassifyQuery classifies info by its first keyword, case-insensitively and
+// ignoring leading whitespace, comments and parentheses.
+func ClassifyQuery(info string) QueryType {
+	switch strings.ToUpper(firstKeyword(info)) {
+	case "SELECT", "WITH":
+		return QuerySelect
+	case "INSERT", "REPLACE":
+		return QueryInsert
+	case "UPDATE":
+		return QueryUpdate
+	case "DELETE":
+		return QueryDelete
+	case "CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME":
+		return QueryDDL
+	case "SHOW":
+		return QueryShow
+	default:
+		return QueryOther
+	}
+}
+
+// firstKeyword returns the first word of sql after skipping whitespace,
+// /* */, -- and # comments, and opening parentheses.
+func firstKeyword(sql string) string {
+	for {
+		sql = strings.TrimLeft(sql, " \t\r\n(")
+		switch {
+		case strings.HasPrefix(sql, "/*"):
+			end := strings.Index(sql, "*/")
+			if end < 0 {
+				return ""
+			}
+			sql = sql[end+2:]
+		case strings.HasPrefix(sql, "--"), strings.HasPrefix(sql, "#"):
+			end := strings.IndexByte(sql, '\n')
+			if end < 0 {
+				return ""
+			}
+			sql = sql[end+1:]
+		default:
+			end := strings.IndexFunc(sql, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				return sql
+			}
+			return sql[:end]
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package catch
+
+import "testing"
+
+func TestFirstKeyword(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want string
+	}{
+		{"", ""},
+		{"SELECT 1", "SELECT"},
+		{"select 1", "select"},
+		{"  \t\r\nSELECT 1", "SELECT"},
+		{"SELECT*FROM t", "SELECT"},
+		{"((SELECT 1) UNION (SELECT 2))", "SELECT"},
+		{"/* app:checkout */ SELECT 1", "SELECT"},
+		{"/* one */ /* two */UPDATE t SET a = 1", "UPDATE"},
+		{"/*+ MAX_EXECUTION_TIME(1000) */ SELECT 1", "SELECT"},
+		{"/* multi\nline */\nDELETE FROM t", "DELETE"},
+		{"/* unterminated SELECT 1", ""},
+		{"-- comment\nINSERT INTO t VALUES (1)", "INSERT"},
+		{"# comment\nSHOW PROCESSLIST", "SHOW"},
+		{"-- one\n# two\n/* three */ ALTER TABLE t ADD c INT", "ALTER"},
+		{"-- only a comment", ""},
+		{"# only a comment", ""},
+		{"SELECT", "SELECT"},
+		{"42", ""},
+	}
+	for _, tt := range tests {
+		if got := firstKeyword(tt.sql); got != tt.want {
+			t.Errorf("firstKeyword(%q) = %q, want %q", tt.sql, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyQuery(t *testing.T) {
+	tests := []struct {
+		info string
+		want QueryType
+	}{
+		{"", QueryOther},
+		{"SELECT * FROM orders", QuerySelect},
+		{"select * from orders", QuerySelect},
+		{"SeLeCt 1", QuerySelect},
+		{"WITH recent AS (SELECT 1) SELECT * FROM recent", QuerySelect},
+		{"(SELECT 1) UNION (SELECT 2)", QuerySelect},
+		{"/* app:checkout */ select 1", QuerySelect},
+		{"-- report\nSELECT 1", QuerySelect},
+		{"# report\nselect 1", QuerySelect},
+		{"INSERT INTO t VALUES (1)", QueryInsert},
+		{"replace into t values (1)", QueryInsert},
+		{"Update t SET a = 1", QueryUpdate},
+		{"/* batch */ DELETE FROM t", QueryDelete},
+		{"CREATE TABLE t (id INT)", QueryDDL},
+		{"alter table t add c int", QueryDDL},
+		{"DROP TABLE t", QueryDDL},
+		{"TRUNCATE t", QueryDDL},
+		{"RENAME TABLE a TO b", QueryDDL},
+		{"SHOW FULL PROCESSLIST", QueryShow},
+		{"show engine innodb status", QueryShow},
+		{"COMMIT", QueryOther},
+		{"SET autocommit = 0", QueryOther},
+		{"SELECTED", QueryOther},
+		{"/* SELECT */", QueryOther},
+	}
+	for _, tt := range tests {
+		if got := ClassifyQuery(tt.info); got != tt.want {
+			t.Errorf("ClassifyQuery(%q) = %v, want %v", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTypeIsQuery(t *testing.T) {
+	for typ, want := range map[QueryType]bool{
+		QuerySelect: true,
+		QueryInsert: true,
+		QueryUpdate: true,
+		QueryDelete: true,
+		QueryDDL:    true,
+		QueryShow:   false,
+		QueryOther:  false,
+	} {
+		if got := typ.IsQuery(); got != want {
+			t.Errorf("%v.IsQuery() = %v, want %v", typ, got, want)
+		}
+	}
+}
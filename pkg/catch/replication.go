@@ -0,0 +1,86 @@
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// replicaColumnNames maps the column names used before MySQL 8.0.22 to the
+// current ones, which say Source and Replica where older ones say Master
+// and Slave.
+var replicaColumnNames = strings.NewReplacer("Master", "Source", "Slave", "Replica")
+
+// ReplicaStatus is the state of one replication channel of a replica.
+type ReplicaStatus struct {
+	// Channel is empty for the default channel
+	Channel string
+	Source  string
+	// SecondsBehind is NULL when the SQL thread isn't running
+	SecondsBehind sql.NullInt64
+	IORunning     string
+	SQLRunning    string
+	// LastError is the last IO or SQL thread error, empty when neither failed
+	LastError string
+}
+
+// Running reports whether both replication threads are running.
+func (s ReplicaStatus) Running() bool {
+	return s.IORunning == "Yes" && s.SQLRunning == "Yes"
+}
+
+// ReplicationStatus reads SHOW REPLICA STATUS from the server behind db,
+// falling back to SHOW SLAVE STATUS before MySQL 8.0.22. It returns one
+// status per channel, and none when the server isn't a replica.
+func ReplicationStatus(ctx context.Context, db *sql.DB) ([]ReplicaStatus, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		if rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS"); err != nil {
+			return nil, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []ReplicaStatus
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := map[string]sql.NullString{}
+		for i, column := range columns {
+			row[replicaColumnNames.Replace(column)] = values[i]
+		}
+		status := ReplicaStatus{
+			Channel:    row["Channel_Name"].String,
+			Source:     row["Source_Host"].String,
+			IORunning:  row["Replica_IO_Running"].String,
+			SQLRunning: row["Replica_SQL_Running"].String,
+			LastError:  row["Last_SQL_Error"].String,
+		}
+		if status.LastError == "" {
+			status.LastError = row["Last_IO_Error"].String
+		}
+		if port := row["Source_Port"].String; port != "" && status.Source != "" {
+			status.Source = net.JoinHostPort(status.Source, port)
+		}
+		if lag := row["Seconds_Behind_Source"]; lag.Valid {
+			if n, err := strconv.ParseInt(lag.String, 10, 64); err == nil {
+				status.SecondsBehind = sql.NullInt64{Int64: n, Valid: true}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, rows.Err()
+}
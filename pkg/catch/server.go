@@ -0,0 +1,140 @@
+package catch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Server flavors told apart by DetectServer
+const (
+	FlavorMySQL   = "mysql"
+	FlavorMariaDB = "mariadb"
+	FlavorPercona = "percona"
+)
+
+// ServerInfo identifies the server software, which decides the columns its
+// processlist offers. The zero value stands for an unknown server and reads
+// only the columns every version has.
+type ServerInfo struct {
+	Flavor string
+	// Version is VERSION() as reported, e.g. 8.0.36-28
+	Version string
+	// Comment is @@version_comment, e.g. MySQL Community Server - GPL
+	Comment             string
+	Major, Minor, Patch int
+	// PerformanceSchema is set when performance_schema is enabled
+	PerformanceSchema bool
+
+	// Hostname and Port are @@hostname and @@port, the machine and port
+	// the server runs on whatever address it was reached at
+	Hostname string
+	Port     int
+	// UUID is @@server_uuid, which tells servers apart across a failover
+	// behind one address. MariaDB has none.
+	UUID string
+}
+
+// DetectServer asks the server behind db for its flavor, version and
+// identity.
+func DetectServer(ctx context.Context, db *sql.DB) (ServerInfo, error) {
+	var version, comment, hostname sql.NullString
+	var perfSchema, port sql.NullInt64
+	err := db.QueryRowContext(ctx, "SELECT VERSION(), @@version_comment, @@performance_schema, @@hostname, @@port").
+		Scan(&version, &comment, &perfSchema, &hostname, &port)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	info := ParseServerInfo(version.String, comment.String)
+	info.PerformanceSchema = perfSchema.Int64 == 1
+	info.Hostname = hostname.String
+	info.Port = int(port.Int64)
+
+	// Asked apart, since MariaDB fails the whole query for it
+	var uuid sql.NullString
+	if err := db.QueryRowContext(ctx, "SELECT @@server_uuid").Scan(&uuid); err == nil {
+		info.UUID = uuid.String
+	} else if ctx.Err() != nil {
+		return ServerInfo{}, ctx.Err()
+	}
+	return info, nil
+}
+
+// ParseServerInfo classifies a server from its VERSION() and
+// @@version_comment values.
+func ParseServerInfo(version, comment string) ServerInfo {
+	info := ServerInfo{Flavor: FlavorMySQL, Version: version, Comment: comment}
+	switch {
+	case strings.Contains(strings.ToLower(version), "mariadb"):
+		info.Flavor = FlavorMariaDB
+	case strings.Contains(strings.ToLower(comment), "percona"):
+		info.Flavor = FlavorPercona
+	}
+
+	// The number part ends at the first '-', as in 10.11.6-MariaDB
+	number, _, _ := strings.Cut(version, "-")
+	parts := strings.SplitN(number, ".", 3)
+	fields := []*int{&info.Major, &info.Minor, &info.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		*fields[i] = n
+	}
+	return info
+}
+
+// AtLeast reports whether the server version is major.minor.patch or later.
+func (s ServerInfo) AtLeast(major, minor, patch int) bool {
+	if s.Major != major {
+		return s.Major > major
+	}
+	if s.Minor != minor {
+		return s.Minor > minor
+	}
+	return s.Patch >= patch
+}
+
+func (s ServerInfo) String() string {
+	if s.Version == "" {
+		return "unknown server"
+	}
+	name := fmt.Sprintf("%s %d.%d (%s", s.Flavor, s.Major, s.Minor, s.Version)
+	if s.Comment != "" {
+		name += ", " + s.Comment
+	}
+	return name + ")"
+}
+
+// ProcessListSource is the table ProcessListFor reads for this server.
+// MySQL 8.0.22 added performance_schema.processlist, which doesn't take
+// the global mutex information_schema.processlist holds while it runs.
+func (s ServerInfo) ProcessListSource() string {
+	if s.Flavor == FlavorMySQL && s.PerformanceSchema && s.AtLeast(8, 0, 22) {
+		return "performance_schema.processlist"
+	}
+	return "information_schema.processlist"
+}
+
+// HasTimeMS reports whether the processlist has a TIME_MS column with the
+// time in milliseconds. MariaDB and Percona Server add it; MySQL only
+// counts whole seconds.
+func (s ServerInfo) HasTimeMS() bool {
+	return s.Flavor == FlavorMariaDB || s.Flavor == FlavorPercona
+}
+
+// rowsExaminedColumn names the processlist column counting the rows the
+// statement examined so far. Only MariaDB and Percona Server have one.
+func (s ServerInfo) rowsExaminedColumn() string {
+	switch s.Flavor {
+	case FlavorMariaDB:
+		return "EXAMINED_ROWS"
+	case FlavorPercona:
+		return "ROWS_EXAMINED"
+	default:
+		return ""
+	}
+}